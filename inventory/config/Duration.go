@@ -0,0 +1,22 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// GetDuration reads a positive duration such as "90s" or "24h" from the
+// environment, falling back when the variable is not set. An invalid value
+// stops the program.
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid duration for %s: %q", key, value)
+	}
+	return duration
+}
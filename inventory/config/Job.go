@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+)
+
+// JobFunc does one run of a background job and returns how many items it
+// handled.
+type JobFunc func(ctx context.Context, now time.Time) (int, error)
+
+// Job runs a JobFunc at a fixed interval and publishes its runs, errors,
+// last run time and handled items as expvar metrics.
+type Job struct {
+	run      JobFunc
+	interval time.Duration
+	done     string
+	failed   string
+
+	items   *expvar.Int
+	runs    *expvar.Int
+	errors  *expvar.Int
+	lastRun *expvar.String
+}
+
+// NewJob creates a job whose metrics are named after name, for example
+// name_runs_total, with the handled items counted in itemsMetric. done is
+// logged with the number of items when a run handled any and failed is
+// logged with the error when a run fails.
+func NewJob(name, itemsMetric string, interval time.Duration, run JobFunc, done, failed string) *Job {
+	return &Job{
+		run:      run,
+		interval: interval,
+		done:     done,
+		failed:   failed,
+		items:    expvar.NewInt(itemsMetric),
+		runs:     expvar.NewInt(name + "_runs_total"),
+		errors:   expvar.NewInt(name + "_errors_total"),
+		lastRun:  expvar.NewString(name + "_last_run"),
+	}
+}
+
+// Run runs the job every interval until ctx is done.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			j.runOnce(ctx, now)
+		}
+	}
+}
+
+func (j *Job) runOnce(ctx context.Context, now time.Time) {
+	j.runs.Add(1)
+	j.lastRun.Set(now.Format(time.RFC3339))
+
+	count, err := j.run(ctx, now)
+	j.items.Add(int64(count))
+	if err != nil {
+		j.errors.Add(1)
+		log.Printf("%s: %v", j.failed, err)
+		return
+	}
+	if count > 0 {
+		log.Printf(j.done, count)
+	}
+}
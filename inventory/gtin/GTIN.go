@@ -0,0 +1,32 @@
+package gtin
+
+// Valid reports whether code is a GTIN-8, GTIN-12 (UPC-A), GTIN-13 (EAN-13)
+// or GTIN-14 with a correct check digit.
+func Valid(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+
+	// Weights alternate 3, 1, 3, ... starting from the digit left of the
+	// check digit
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		digit := int(c - '0')
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	check := code[len(code)-1]
+	if check < '0' || check > '9' {
+		return false
+	}
+	return (10-sum%10)%10 == int(check-'0')
+}
@@ -0,0 +1,36 @@
+package gtin
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"GTIN-8", "96385074", true},
+		{"GTIN-8 wrong check digit", "96385075", false},
+		{"GTIN-12", "036000291452", true},
+		{"GTIN-12 wrong check digit", "036000291453", false},
+		{"GTIN-13", "4006381333931", true},
+		{"GTIN-13 wrong check digit", "4006381333932", false},
+		{"GTIN-13 check digit 0", "4006381333900", true},
+		{"GTIN-14", "10012345678902", true},
+		{"GTIN-14 wrong check digit", "10012345678901", false},
+		{"all zeros", "00000000", true},
+		{"empty", "", false},
+		{"too short", "1234567", false},
+		{"unsupported length", "12345678901", false},
+		{"too long", "123456789012345", false},
+		{"letter", "4006381A33931", false},
+		{"letter as check digit", "400638133393X", false},
+		{"space", "4006381 33931", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.code); got != tt.want {
+				t.Errorf("Valid(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"inventory/models"
+	"inventory/repository"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validateAttributeSchema checks a category's attribute definitions.
+func validateAttributeSchema(definitions []models.AttributeDefinition) error {
+	names := map[string]bool{}
+	for _, definition := range definitions {
+		if definition.Name == "" || strings.ContainsAny(definition.Name, ".$") {
+			return fmt.Errorf("Attribute name is required and may not contain '.' or '$'")
+		}
+		if names[definition.Name] {
+			return fmt.Errorf("Duplicate attribute %s", definition.Name)
+		}
+		names[definition.Name] = true
+
+		switch definition.Type {
+		case models.AttributeString, models.AttributeNumber, models.AttributeBoolean:
+			if len(definition.Values) > 0 {
+				return fmt.Errorf("Only enum attributes may list values, %s is a %s", definition.Name, definition.Type)
+			}
+		case models.AttributeEnum:
+			if len(definition.Values) == 0 {
+				return fmt.Errorf("Enum attribute %s must list its values", definition.Name)
+			}
+		default:
+			return fmt.Errorf("Attribute %s has invalid type %q, must be one of: string, number, boolean, enum", definition.Name, definition.Type)
+		}
+	}
+	return nil
+}
+
+// categorySchema returns the attributes products in a category carry: those
+// of its ancestors, from the root down, followed by its own. A definition
+// lower in the tree replaces one of the same name above it.
+func categorySchema(ctx context.Context, category models.Category) ([]models.AttributeDefinition, error) {
+	chain := []models.Category{category}
+	if len(category.Ancestors) > 0 {
+		cursor, err := categoriesCollection.Find(ctx, bson.M{"_id": bson.M{"$in": category.Ancestors}})
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var ancestors []models.Category
+		if err := cursor.All(ctx, &ancestors); err != nil {
+			return nil, err
+		}
+
+		// Order the ancestors as in the path, root first
+		byID := map[string]models.Category{}
+		for _, ancestor := range ancestors {
+			byID[ancestor.ID.Hex()] = ancestor
+		}
+		chain = chain[:0]
+		for _, id := range category.Ancestors {
+			if ancestor, ok := byID[id.Hex()]; ok {
+				chain = append(chain, ancestor)
+			}
+		}
+		chain = append(chain, category)
+	}
+	return mergeSchema(chain), nil
+}
+
+// mergeSchema combines the attributes of a chain of categories, root first.
+// A definition lower in the chain replaces one of the same name above it.
+func mergeSchema(chain []models.Category) []models.AttributeDefinition {
+	var schema []models.AttributeDefinition
+	index := map[string]int{}
+	for _, c := range chain {
+		for _, definition := range c.Attributes {
+			if i, ok := index[definition.Name]; ok {
+				schema[i] = definition
+				continue
+			}
+			index[definition.Name] = len(schema)
+			schema = append(schema, definition)
+		}
+	}
+	return schema
+}
+
+// validateAttributes checks product attribute values against a schema,
+// reporting unknown attributes, missing required ones and values of the
+// wrong type as attributes.<name> field errors.
+func validateAttributes(schema []models.AttributeDefinition, values map[string]interface{}) []fieldError {
+	errs := []fieldError{}
+	definitions := map[string]models.AttributeDefinition{}
+	for _, definition := range schema {
+		definitions[definition.Name] = definition
+		if _, ok := values[definition.Name]; definition.Required && !ok {
+			errs = append(errs, fieldError{"attributes." + definition.Name, fmt.Sprintf("Attribute %s is required", definition.Name)})
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := values[name]
+		definition, ok := definitions[name]
+		if !ok {
+			errs = append(errs, fieldError{"attributes." + name, fmt.Sprintf("Unknown attribute %s for this category", name)})
+			continue
+		}
+
+		valid := false
+		switch definition.Type {
+		case models.AttributeString:
+			_, valid = value.(string)
+		case models.AttributeNumber:
+			_, valid = value.(float64)
+		case models.AttributeBoolean:
+			_, valid = value.(bool)
+		case models.AttributeEnum:
+			s, ok := value.(string)
+			for _, allowed := range definition.Values {
+				valid = valid || (ok && s == allowed)
+			}
+		}
+		if !valid {
+			message := fmt.Sprintf("Attribute %s must be a %s", name, definition.Type)
+			if definition.Type == models.AttributeEnum {
+				message = fmt.Sprintf("Attribute %s must be one of: %s", name, strings.Join(definition.Values, ", "))
+			}
+			errs = append(errs, fieldError{"attributes." + name, message})
+		}
+	}
+	return errs
+}
+
+// attributeError reports product attribute values that do not match the
+// category schema.
+type attributeError struct {
+	error
+}
+
+// checkProductAttributes validates attribute values against the schema of
+// the product's category.
+func checkProductAttributes(ctx context.Context, category models.Category, values map[string]interface{}) error {
+	schema, err := categorySchema(ctx, category)
+	if err != nil {
+		return err
+	}
+	if errs := validateAttributes(schema, values); len(errs) > 0 {
+		return attributeError{fieldErrors(errs)}
+	}
+	return nil
+}
+
+func respondWithAttributeError(w http.ResponseWriter, err error) {
+	if ae, ok := err.(attributeError); ok {
+		repository.RespondWithError(w, http.StatusBadRequest, ae.Error())
+		return
+	}
+	repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+// attributeFilter builds conditions from attr.<name> parameters. A value
+// matches as a string and, where it parses as one, as a number or boolean;
+// comma-separated values match any of them. attr.<name>.min and
+// attr.<name>.max give a numeric range. Conditions on the same attribute
+// must all hold.
+func attributeFilter(values url.Values) (bson.M, error) {
+	filter := bson.M{}
+	condition := func(field string) bson.M {
+		c, ok := filter[field].(bson.M)
+		if !ok {
+			c = bson.M{}
+			filter[field] = c
+		}
+		return c
+	}
+	for key := range values {
+		if !strings.HasPrefix(key, "attr.") {
+			continue
+		}
+		name := strings.TrimPrefix(key, "attr.")
+
+		bound := ""
+		if strings.HasSuffix(name, ".min") || strings.HasSuffix(name, ".max") {
+			bound = name[len(name)-3:]
+			name = name[:len(name)-4]
+		}
+		if name == "" || strings.ContainsAny(name, ".$") {
+			return nil, filterError{fmt.Errorf("invalid attribute filter: %s", key)}
+		}
+		field := "attributes." + name
+
+		if bound != "" {
+			number, err := strconv.ParseFloat(values.Get(key), 64)
+			if err != nil {
+				return nil, filterError{fmt.Errorf("invalid %s: %s", key, values.Get(key))}
+			}
+			if bound == "min" {
+				condition(field)["$gte"] = number
+			} else {
+				condition(field)["$lte"] = number
+			}
+			continue
+		}
+
+		var matches []interface{}
+		for _, value := range strings.Split(values.Get(key), ",") {
+			matches = append(matches, value)
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				matches = append(matches, number)
+			}
+			if boolean, err := strconv.ParseBool(value); err == nil {
+				matches = append(matches, boolean)
+			}
+		}
+		condition(field)["$in"] = matches
+	}
+	return filter, nil
+}
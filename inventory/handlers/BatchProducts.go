@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/jsonpatch"
+	"inventory/models"
+	"inventory/repository"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxBatchOperations = 500
+
+var errBatchFailed = errors.New("Not applied, another operation in the batch failed")
+
+// batchResult reports the outcome of one operation of a batch.
+type batchResult struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	ID      string       `json:"id,omitempty"`
+	Status  int          `json:"status"`
+	Version int64        `json:"version,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+func (r *batchResult) failed() bool {
+	return r.Status >= http.StatusBadRequest
+}
+
+// batchWrite is a checked operation waiting to be written.
+type batchWrite struct {
+	index     int
+	model     mongo.WriteModel
+	productID primitive.ObjectID
+	versioned bool
+	update    bool
+	oldPrice  float64
+	newPrice  float64
+}
+
+// BatchProducts runs a list of create, update and delete operations with a
+// single bulk write and reports the result of each one. Operations are
+// checked like their single-product counterparts first; in transactional
+// mode nothing is written unless every operation succeeds.
+func BatchProducts(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	var req models.BatchProductsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Operations) == 0 {
+		repository.RespondWithError(w, http.StatusBadRequest, "At least one operation is required")
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		repository.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("A batch cannot have more than %d operations", maxBatchOperations))
+		return
+	}
+
+	// Every write is marked with a token of its own batch, which tells the
+	// writes that were applied from those that lost a race with another
+	// writer
+	batch := productBatch{
+		token: primitive.NewObjectID(),
+		now:   time.Now(),
+		seen:  map[primitive.ObjectID]bool{},
+		slugs: map[string]bool{},
+	}
+
+	// Check the operations and build their writes
+	results := make([]batchResult, len(req.Operations))
+	writes := []batchWrite{}
+	for i, op := range req.Operations {
+		results[i] = batchResult{Index: i, Op: op.Op, ID: op.ID}
+		if write, ok := batch.prepare(ctx, op, &results[i]); ok {
+			write.index = i
+			writes = append(writes, write)
+		}
+	}
+
+	var err error
+	if req.Transactional {
+		if countFailedResults(results) == 0 {
+			err = writeBatchTransaction(ctx, writes, batch.token, results)
+		}
+		if err == nil && countFailedResults(results) > 0 {
+			for i := range results {
+				if !results[i].failed() {
+					results[i].Status = http.StatusFailedDependency
+					results[i].Version = 0
+					results[i].Error = errBatchFailed.Error()
+				}
+			}
+		}
+	} else {
+		var failures map[int]error
+		failures, err = writeBatch(ctx, writes, batch.token, false)
+		if err == nil {
+			setBatchFailures(results, writes, failures)
+			if err := recordBatchPriceChanges(ctx, writes, failures); err != nil {
+				log.Printf("Failed to record price changes of batch: %v", err)
+			}
+		}
+	}
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	failed := countFailedResults(results)
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	repository.RespondWithJSON(w, status, map[string]interface{}{
+		"transactional": req.Transactional,
+		"succeeded":     len(results) - failed,
+		"failed":        failed,
+		"results":       results,
+	})
+}
+
+// productBatch is the state shared by the operations of one batch.
+type productBatch struct {
+	token primitive.ObjectID
+	now   time.Time
+
+	// seen holds the products operated on, slugs the slugs the writes will
+	// take so that no two operations get the same one
+	seen  map[primitive.ObjectID]bool
+	slugs map[string]bool
+}
+
+// prepare checks one operation and returns its write. It returns false if
+// the operation failed or has nothing to write, with the outcome in result.
+func (b *productBatch) prepare(ctx context.Context, op models.BatchOperation, result *batchResult) (batchWrite, bool) {
+	fail := func(status int, message string) (batchWrite, bool) {
+		result.Status = status
+		result.Error = message
+		return batchWrite{}, false
+	}
+
+	if op.Op == "create" {
+		if len(op.Product) == 0 {
+			return fail(http.StatusBadRequest, "Create needs a product")
+		}
+		var req models.CreateProductRequest
+		if err := json.Unmarshal(op.Product, &req); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+
+		product, err := buildProduct(ctx, req, primitive.NewObjectID(), b.slugs)
+		if err != nil {
+			return fail(productErrorStatus(err), err.Error())
+		}
+		product.CreatedAt = b.now
+		product.UpdatedAt = b.now
+		b.slugs[product.Slug] = true
+
+		result.ID = product.ID.Hex()
+		result.Status = http.StatusCreated
+		result.Version = product.Version
+		return batchWrite{model: mongo.NewInsertOneModel().SetDocument(product), productID: product.ID}, true
+	}
+	if op.Op != "update" && op.Op != "delete" {
+		return fail(http.StatusBadRequest, "Invalid op, must be one of: create, update, delete")
+	}
+
+	// Convert string ID to ObjectID
+	id, err := primitive.ObjectIDFromHex(op.ID)
+	if err != nil {
+		return fail(http.StatusBadRequest, "Invalid product ID")
+	}
+	if b.seen[id] {
+		return fail(http.StatusBadRequest, "Product appears in more than one operation")
+	}
+	b.seen[id] = true
+
+	// Check if product exists
+	var existingProduct models.Product
+	err = productsCollection.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&existingProduct)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fail(http.StatusNotFound, "Product not found")
+		}
+		return fail(http.StatusInternalServerError, err.Error())
+	}
+	if op.Version != nil && *op.Version != existingProduct.Version {
+		return fail(http.StatusPreconditionFailed, "Product has been modified")
+	}
+
+	// Only write over the version that was read and checked
+	filter := bson.M{"_id": id, "version": existingProduct.Version}
+	write := batchWrite{productID: id, versioned: op.Version != nil, update: true}
+
+	if op.Op == "delete" {
+		write.model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{
+			"$set": bson.M{"deleted_at": b.now, "updated_at": b.now, "batch_token": b.token},
+			"$inc": bson.M{"version": 1},
+		})
+		result.Status = http.StatusNoContent
+		return write, true
+	}
+
+	// Apply the merge patch to the product's editable fields
+	if len(op.Product) == 0 {
+		return fail(http.StatusBadRequest, "Update needs a product patch")
+	}
+	var patch interface{}
+	if err := json.Unmarshal(op.Product, &patch); err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	doc, errs := decodeProductDocument(jsonpatch.Merge(newProductDocument(existingProduct), patch), existingProduct)
+	if len(errs) > 0 {
+		result.Fields = errs
+		return fail(http.StatusUnprocessableEntity, "Invalid product")
+	}
+
+	updateDoc, err := productUpdate(ctx, existingProduct, doc, b.slugs)
+	if errs, ok := err.(fieldErrors); ok {
+		result.Fields = errs
+		return fail(http.StatusUnprocessableEntity, "Invalid product")
+	}
+	if err != nil {
+		return fail(productErrorStatus(err), err.Error())
+	}
+	result.Status = http.StatusOK
+	result.Version = existingProduct.Version
+	if updateDoc == nil {
+		return batchWrite{}, false
+	}
+	set := updateDoc["$set"].(bson.M)
+	set["updated_at"] = b.now
+	set["batch_token"] = b.token
+	if newSlug, ok := set["slug"].(string); ok {
+		b.slugs[newSlug] = true
+	}
+
+	write.model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(updateDoc)
+	write.oldPrice = existingProduct.Price
+	write.newPrice = doc.Price
+	result.Version++
+	return write, true
+}
+
+// writeBatchTransaction applies the writes in a transaction, which is only
+// committed if all of them succeed. Failed writes are reported in results.
+func writeBatchTransaction(ctx context.Context, writes []batchWrite, token primitive.ObjectID, results []batchResult) error {
+	// Start a session for transaction
+	session, err := Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	var failures map[int]error
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		var err error
+		failures, err = writeBatch(sessionContext, writes, token, true)
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return errBatchFailed
+		}
+
+		// Record the price changes
+		if err := recordBatchPriceChanges(sessionContext, writes, failures); err != nil {
+			return err
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		// Transaction failed, handle the error
+		session.AbortTransaction(ctx)
+		if err != errBatchFailed {
+			return err
+		}
+		setBatchFailures(results, writes, failures)
+	}
+	return nil
+}
+
+// writeBatch bulk writes the operations and returns the error of each write
+// that failed, keyed by its position in writes. An ordered write stops at the
+// first failure.
+func writeBatch(ctx context.Context, writes []batchWrite, token primitive.ObjectID, ordered bool) (map[int]error, error) {
+	failures := map[int]error{}
+	if len(writes) == 0 {
+		return failures, nil
+	}
+
+	writeModels := make([]mongo.WriteModel, len(writes))
+	for i, write := range writes {
+		writeModels[i] = write.model
+	}
+
+	_, err := productsCollection.BulkWrite(ctx, writeModels, options.BulkWrite().SetOrdered(ordered))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			failures[writeErr.Index] = writeErr
+		}
+		if ordered {
+			return failures, nil
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Updates filter on the version that was read, so one that matched
+	// nothing lost a race and left the product without this batch's token
+	ids := []primitive.ObjectID{}
+	for i, write := range writes {
+		if _, ok := failures[i]; !ok && write.update {
+			ids = append(ids, write.productID)
+		}
+	}
+	if len(ids) == 0 {
+		return failures, nil
+	}
+
+	cursor, err := productsCollection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "batch_token": token},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var written []models.Product
+	if err := cursor.All(ctx, &written); err != nil {
+		return nil, err
+	}
+	applied := map[primitive.ObjectID]bool{}
+	for _, product := range written {
+		applied[product.ID] = true
+	}
+	for i, write := range writes {
+		if _, ok := failures[i]; !ok && write.update && !applied[write.productID] {
+			failures[i] = errProductChanged
+		}
+	}
+	return failures, nil
+}
+
+// setBatchFailures reports the failed writes in their operations' results.
+func setBatchFailures(results []batchResult, writes []batchWrite, failures map[int]error) {
+	for i, err := range failures {
+		write := writes[i]
+		result := &results[write.index]
+		result.Version = 0
+		switch {
+		case err == errProductChanged && write.versioned:
+			result.Status = http.StatusPreconditionFailed
+			result.Error = "Product has been modified"
+		case err == errProductChanged:
+			result.Status = http.StatusConflict
+			result.Error = err.Error()
+		case mongo.IsDuplicateKeyError(err):
+			result.Status = http.StatusConflict
+			result.Error = "Slug, SKU or barcode is already in use"
+		default:
+			result.Status = http.StatusInternalServerError
+			result.Error = err.Error()
+		}
+	}
+}
+
+// recordBatchPriceChanges records the price changes of the applied updates.
+func recordBatchPriceChanges(ctx context.Context, writes []batchWrite, failures map[int]error) error {
+	for i, write := range writes {
+		if _, ok := failures[i]; ok || !write.update || write.oldPrice == write.newPrice {
+			continue
+		}
+		if err := recordPriceChange(ctx, write.productID, write.oldPrice, write.newPrice, "update", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countFailedResults(results []batchResult) int {
+	failed := 0
+	for i := range results {
+		if results[i].failed() {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/models"
+	"net/http"
+)
+
+// checkBundleComponents makes sure a bundle has components, that each is an
+// existing product other than a bundle and that products with variants are
+// included by variant.
+func checkBundleComponents(ctx context.Context, bundleID primitive.ObjectID, components []models.BundleComponent) error {
+	if len(components) == 0 {
+		return productError{http.StatusBadRequest, "A bundle needs at least one component"}
+	}
+
+	ids := []primitive.ObjectID{}
+	seen := map[string]bool{}
+	for _, component := range components {
+		if component.Quantity <= 0 {
+			return productError{http.StatusBadRequest, "Component quantity must be greater than zero"}
+		}
+		if component.ProductID == bundleID {
+			return productError{http.StatusBadRequest, "A bundle cannot contain itself"}
+		}
+
+		key := component.ProductID.Hex()
+		if component.VariantID != nil {
+			key += "/" + component.VariantID.Hex()
+		}
+		if seen[key] {
+			return productError{http.StatusBadRequest, fmt.Sprintf("Duplicate component %s", key)}
+		}
+		seen[key] = true
+		ids = append(ids, component.ProductID)
+	}
+
+	products, err := findComponentProducts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, component := range components {
+		product, ok := products[component.ProductID]
+		if !ok {
+			return productError{http.StatusBadRequest, fmt.Sprintf("Component product %s not found", component.ProductID.Hex())}
+		}
+		if product.Type == models.ProductTypeBundle {
+			return productError{http.StatusBadRequest, "A bundle cannot contain other bundles"}
+		}
+		if component.VariantID == nil {
+			if len(product.Variants) > 0 {
+				return productError{http.StatusBadRequest, fmt.Sprintf("Component product %s requires a variant ID", component.ProductID.Hex())}
+			}
+			continue
+		}
+		if product.Variant(*component.VariantID) == nil {
+			return productError{http.StatusBadRequest, fmt.Sprintf("Variant %s not found for component product %s", component.VariantID.Hex(), component.ProductID.Hex())}
+		}
+	}
+	return nil
+}
+
+// setBundleStock sets the stock level of each bundle among products to the
+// number of complete bundles its components' stock allows. Other products
+// are left alone.
+func setBundleStock(ctx context.Context, products []models.Product) error {
+	ids := []primitive.ObjectID{}
+	for _, product := range products {
+		if product.Type != models.ProductTypeBundle {
+			continue
+		}
+		for _, component := range product.Components {
+			ids = append(ids, component.ProductID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	components, err := findComponentProducts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		if products[i].Type == models.ProductTypeBundle {
+			products[i].StockLevel = bundleStock(products[i], components)
+		}
+	}
+	return nil
+}
+
+// bundleStock returns how many bundles can be put together from the stock of
+// their components. A missing component makes the bundle unavailable.
+func bundleStock(bundle models.Product, components map[primitive.ObjectID]models.Product) int {
+	available := -1
+	for _, component := range bundle.Components {
+		product, ok := components[component.ProductID]
+		if !ok || component.Quantity <= 0 {
+			return 0
+		}
+
+		stockLevel := product.StockLevel
+		if component.VariantID != nil {
+			variant := product.Variant(*component.VariantID)
+			if variant == nil {
+				return 0
+			}
+			stockLevel = variant.StockLevel
+		}
+
+		if n := stockLevel / component.Quantity; available < 0 || n < available {
+			available = n
+		}
+	}
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// bundleStockStages sets the stock level of bundles in an aggregation to the
+// number of complete bundles their components' stock allows, as bundleStock
+// does, so that bundles can be filtered, sorted and counted by it. Other
+// products keep their stock level.
+func bundleStockStages() mongo.Pipeline {
+	// The stock of one component's product or variant, null if it is gone
+	componentStock := bson.M{"$cond": bson.A{
+		bson.M{"$ifNull": bson.A{"$$component.variant_id", false}},
+		bson.M{"$first": bson.M{"$map": bson.M{
+			"input": bson.M{"$filter": bson.M{
+				"input": "$$product.variants",
+				"as":    "variant",
+				"cond":  bson.M{"$eq": bson.A{"$$variant._id", "$$component.variant_id"}},
+			}},
+			"as": "variant",
+			"in": "$$variant.stock_level",
+		}}},
+		"$$product.stock_level",
+	}}
+
+	// How many bundles one component allows, 0 if it is missing
+	componentBundles := bson.M{"$let": bson.M{
+		"vars": bson.M{"product": bson.M{"$first": bson.M{"$filter": bson.M{
+			"input": "$bundle_components",
+			"as":    "candidate",
+			"cond": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$$candidate._id", "$$component.product_id"}},
+				bson.M{"$eq": bson.A{bson.M{"$type": "$$candidate.deleted_at"}, "missing"}},
+			}},
+		}}}},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$$component.quantity", 0}},
+			bson.M{"$ifNull": bson.A{bson.M{"$floor": bson.M{"$divide": bson.A{componentStock, "$$component.quantity"}}}, 0}},
+			0,
+		}},
+	}}
+
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         productsCollection.Name(),
+			"localField":   "components.product_id",
+			"foreignField": "_id",
+			"as":           "bundle_components",
+		}}},
+		{{Key: "$set", Value: bson.M{"stock_level": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$type", models.ProductTypeBundle}},
+			bson.M{"$ifNull": bson.A{
+				bson.M{"$min": bson.M{"$map": bson.M{"input": "$components", "as": "component", "in": componentBundles}}},
+				0,
+			}},
+			"$stock_level",
+		}}}}},
+		{{Key: "$unset", Value: "bundle_components"}},
+	}
+}
+
+// findComponentProducts loads the products that are not deleted among ids.
+func findComponentProducts(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Product, error) {
+	cursor, err := productsCollection.Find(ctx, notDeleted(bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	return byID, nil
+}
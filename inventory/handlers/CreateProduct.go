@@ -12,6 +12,48 @@ import (
 	"time"
 )
 
+// productError reports a create request that no product can be built from.
+type productError struct {
+	status  int
+	message string
+}
+
+func (e productError) Error() string {
+	return e.message
+}
+
+// respondWithProductError answers with the status of any of the errors
+// buildProduct returns.
+func respondWithProductError(w http.ResponseWriter, err error) {
+	if errs, ok := err.(fieldErrors); ok {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+	repository.RespondWithError(w, productErrorStatus(err), err.Error())
+}
+
+// productErrorStatus returns the response status for an error returned by
+// buildProduct.
+func productErrorStatus(err error) int {
+	switch e := err.(type) {
+	case productError:
+		return e.status
+	case attributeError:
+		return http.StatusBadRequest
+	case identifierError:
+		return e.status
+	case fieldErrors:
+		return http.StatusUnprocessableEntity
+	}
+	switch err {
+	case errInvalidSlug:
+		return http.StatusBadRequest
+	case errSlugTaken:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 func CreateProduct(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	var req models.CreateProductRequest
@@ -21,25 +63,86 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Create new product
+	product, err := buildProduct(ctx, req, primitive.NewObjectID(), nil)
+	if err != nil {
+		respondWithProductError(w, err)
+		return
+	}
+
+	// Insert product
+	_, err = productsCollection.InsertOne(ctx, product)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithProduct(w, http.StatusCreated, product)
+}
+
+// buildProduct validates a create request and returns the product to store
+// under the given ID. A generated slug avoids the reserved ones. Invalid
+// requests are reported as productError,
+// attributeError, identifierError or a slug error.
+func buildProduct(ctx context.Context, req models.CreateProductRequest, productID primitive.ObjectID, reservedSlugs map[string]bool) (models.Product, error) {
+	var product models.Product
+
 	// Basic validation
 	if req.Name == "" {
-		repository.RespondWithError(w, http.StatusBadRequest, "Product name is required")
-		return
+		return product, productError{http.StatusBadRequest, "Product name is required"}
 	}
 	if req.Price <= 0 {
-		repository.RespondWithError(w, http.StatusBadRequest, "Price must be greater than zero")
-		return
+		return product, productError{http.StatusBadRequest, "Price must be greater than zero"}
 	}
 	if req.StockLevel < 0 {
-		repository.RespondWithError(w, http.StatusBadRequest, "Stock level cannot be negative")
-		return
+		return product, productError{http.StatusBadRequest, "Stock level cannot be negative"}
+	}
+	if req.Weight < 0 {
+		return product, productError{http.StatusBadRequest, "Weight cannot be negative"}
+	}
+	if req.Dimensions.Length < 0 || req.Dimensions.Width < 0 || req.Dimensions.Height < 0 {
+		return product, productError{http.StatusBadRequest, "Dimensions cannot be negative"}
+	}
+
+	// Validate options and variants
+	if err := validateOptions(req.Options); err != nil {
+		return product, productError{http.StatusBadRequest, err.Error()}
+	}
+	variants, err := buildVariants(req.Options, req.Variants)
+	if err != nil {
+		return product, productError{http.StatusBadRequest, err.Error()}
+	}
+
+	// Products with variants hold the sum of the variant stock
+	stockLevel := req.StockLevel
+	if variants != nil {
+		stockLevel = variantStock(variants)
+	}
+
+	// Bundles are made of other products and hold no stock of their own
+	switch req.Type {
+	case "":
+		if len(req.Components) > 0 {
+			return product, productError{http.StatusBadRequest, "Only bundles have components"}
+		}
+	case models.ProductTypeBundle:
+		if len(req.Options) > 0 || len(req.Variants) > 0 {
+			return product, productError{http.StatusBadRequest, "Bundles cannot have options or variants"}
+		}
+		if req.StockLevel != 0 {
+			return product, productError{http.StatusBadRequest, "Stock of a bundle is computed from its components"}
+		}
+		if err := checkBundleComponents(ctx, productID, req.Components); err != nil {
+			return product, err
+		}
+	default:
+		return product, productError{http.StatusBadRequest, "Invalid product type, must be bundle or left out"}
 	}
 
 	// Convert string category ID to ObjectID
 	categoryID, err := primitive.ObjectIDFromHex(req.CategoryID)
 	if err != nil {
-		repository.RespondWithError(w, http.StatusBadRequest, "Invalid category ID")
-		return
+		return product, productError{http.StatusBadRequest, "Invalid category ID"}
 	}
 
 	// Check if category exists
@@ -47,32 +150,47 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 	err = categoriesCollection.FindOne(ctx, bson.M{"_id": categoryID}).Decode(&categoryDoc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			repository.RespondWithError(w, http.StatusBadRequest, "Category not found")
-			return
+			return product, productError{http.StatusBadRequest, "Category not found"}
 		}
-		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return product, err
+	}
+
+	// Check attributes against the category schema
+	if err := checkProductAttributes(ctx, categoryDoc, req.Attributes); err != nil {
+		return product, err
+	}
+
+	productSlug, err := resolveSlug(ctx, productsCollection, req.Slug, req.Name, productID, reservedSlugs)
+	if err != nil {
+		return product, err
 	}
 
-	// Create new product
 	now := time.Now()
-	product := models.Product{
-		ID:          primitive.NewObjectID(),
+	product = models.Product{
+		ID:          productID,
 		Name:        req.Name,
+		Slug:        productSlug,
+		SKU:         req.SKU,
+		Barcode:     req.Barcode,
 		Description: req.Description,
 		Price:       req.Price,
-		StockLevel:  req.StockLevel,
+		StockLevel:  stockLevel,
+		Weight:      req.Weight,
+		Dimensions:  req.Dimensions,
 		CategoryID:  categoryID,
+		Options:     req.Options,
+		Variants:    variants,
+		Type:        req.Type,
+		Components:  req.Components,
+		Attributes:  req.Attributes,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Version:     1,
 	}
 
-	// Insert product
-	_, err = productsCollection.InsertOne(ctx, product)
-	if err != nil {
-		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+	// Check SKUs and barcodes
+	if err := checkIdentifiers(ctx, product); err != nil {
+		return product, err
 	}
-
-	repository.RespondWithJSON(w, http.StatusCreated, product)
+	return product, nil
 }
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/models"
+	"inventory/repository"
+	"net/http"
+	"time"
+)
+
+var (
+	errCategoryInUse          = errors.New("Cannot delete category that is referenced by products")
+	errCategoryInUseByDeleted = errors.New("Cannot delete category that is referenced by deleted products, use reassign_to to move them")
+)
+
+// DeleteCategory deletes a category that has no subcategories. Products in
+// the category block the deletion unless reassign_to names another category
+// to move them to, in which case both happen in one transaction. Deleted
+// products block the deletion too, so they can still be restored, and are
+// moved along with the rest. Moved products must fit the attribute schema of
+// the category they are moved to.
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Convert the ID to ObjectID type
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	// Check if category exists
+	var category models.Category
+	err = categoriesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Category not found")
+		} else {
+			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// Check for subcategories
+	childCount, err := categoriesCollection.CountDocuments(ctx, bson.M{"parent_id": id})
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if childCount > 0 {
+		repository.RespondWithError(w, http.StatusConflict, "Cannot delete category that has subcategories")
+		return
+	}
+
+	// Resolve the category to move products to, if any
+	var reassignTo *primitive.ObjectID
+	var targetSchema []models.AttributeDefinition
+	if reassignStr := r.URL.Query().Get("reassign_to"); reassignStr != "" {
+		targetID, err := primitive.ObjectIDFromHex(reassignStr)
+		if err != nil || targetID == id {
+			repository.RespondWithError(w, http.StatusBadRequest, "Invalid reassignment category ID")
+			return
+		}
+		var target models.Category
+		err = categoriesCollection.FindOne(ctx, bson.M{"_id": targetID}).Decode(&target)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				repository.RespondWithError(w, http.StatusBadRequest, "Reassignment category not found")
+			} else {
+				repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		targetSchema, err = categorySchema(ctx, target)
+		if err != nil {
+			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		reassignTo = &targetID
+	}
+
+	// Start a session for transaction
+	session, err := Client.StartSession()
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		if reassignTo != nil {
+			// The moved products must fit the attributes of their new category
+			invalid, err := findUnfitProducts(sessionContext, targetSchema, bson.M{"category_id": id}, []invalidProduct{})
+			if err != nil {
+				return err
+			}
+			if len(invalid) > 0 {
+				return categorySchemaError{invalid}
+			}
+
+			// Deleted products are moved too, so restoring them works
+			_, err = productsCollection.UpdateMany(
+				sessionContext,
+				bson.M{"category_id": id},
+				bson.M{"$set": bson.M{"category_id": *reassignTo, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+			)
+			if err != nil {
+				return err
+			}
+		} else {
+			productCount, err := productsCollection.CountDocuments(sessionContext, notDeleted(bson.M{"category_id": id}))
+			if err != nil {
+				return err
+			}
+			if productCount > 0 {
+				return errCategoryInUse
+			}
+			deletedCount, err := productsCollection.CountDocuments(sessionContext, bson.M{"category_id": id})
+			if err != nil {
+				return err
+			}
+			if deletedCount > 0 {
+				return errCategoryInUseByDeleted
+			}
+		}
+
+		_, err := categoriesCollection.DeleteOne(sessionContext, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		// Transaction failed, handle the error
+		session.AbortTransaction(ctx)
+		if err == errCategoryInUse || err == errCategoryInUseByDeleted {
+			repository.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if schemaErr, ok := err.(categorySchemaError); ok {
+			repository.RespondWithJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":    "Products do not fit the attributes of the reassignment category",
+				"products": schemaErr.products,
+			})
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Respond with HTTP 204 No Content
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"inventory/models"
 	"net/http"
+	"time"
 )
 
 func DeleteProduct(w http.ResponseWriter, r *http.Request) {
@@ -22,9 +23,9 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if product exists in products collection
+	// Check if product exists and is not deleted yet
 	var product models.Product
-	err = productsCollection.FindOne(context.Background(), bson.M{"_id": productID}).Decode(&product)
+	err = productsCollection.FindOne(context.Background(), notDeleted(bson.M{"_id": productID})).Decode(&product)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			http.Error(w, "Product not found", http.StatusNotFound)
@@ -33,26 +34,26 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
-	// Check if product is referenced in any order_items
-	var orderCount int64
-	orderFilter := bson.M{"product_id": productID}
-	orderCount, err = ordersCollection.CountDocuments(context.Background(), orderFilter)
-	if err != nil {
-		http.Error(w, "Failed to check orders referencing product", http.StatusInternalServerError)
-		return
-	}
-	if orderCount > 0 {
-		http.Error(w, "Cannot delete product that is referenced in orders", http.StatusConflict)
+	if !checkIfMatch(w, r, product) {
 		return
 	}
 
-	// Delete the product from the products collection
-	_, err = productsCollection.DeleteOne(context.Background(), bson.M{"_id": productID})
+	// Mark the product as deleted, the purge job removes it for good once
+	// the retention period has passed and no orders refer to it
+	now := time.Now()
+	result, err := productsCollection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": productID, "version": product.Version},
+		bson.M{"$set": bson.M{"deleted_at": now, "updated_at": now}, "$inc": bson.M{"version": 1}},
+	)
 	if err != nil {
 		http.Error(w, "Failed to delete product", http.StatusInternalServerError)
 		return
 	}
+	if result.MatchedCount == 0 {
+		respondWithProductChanged(w, r)
+		return
+	}
 
 	// Respond with HTTP 204 No Content
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"hash/fnv"
+	"inventory/models"
+	"inventory/repository"
+	"net/http"
+	"strings"
+)
+
+// productETag derives a product's ETag from its version, which every write
+// increments. A bundle's stock follows its components, so their versions
+// are part of its ETag too.
+func productETag(ctx context.Context, product models.Product) (string, error) {
+	if product.Type != models.ProductTypeBundle {
+		return fmt.Sprintf(`"%d"`, product.Version), nil
+	}
+
+	ids := make([]primitive.ObjectID, len(product.Components))
+	for i, component := range product.Components {
+		ids[i] = component.ProductID
+	}
+	components, err := findComponentProducts(ctx, ids)
+	if err != nil {
+		return "", err
+	}
+
+	// A missing component counts as version 0
+	hash := fnv.New64a()
+	for _, component := range product.Components {
+		fmt.Fprintf(hash, "%s:%d;", component.ProductID.Hex(), components[component.ProductID].Version)
+	}
+	return fmt.Sprintf(`"%d-%x"`, product.Version, hash.Sum64()), nil
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// If-Match uses the strong comparison, where weak tags never match, and
+// If-None-Match the weak one, where they compare equal to strong ones.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch answers 412 and returns false if the request has an If-Match
+// header that does not match the product's current ETag.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, product models.Product) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	etag, err := productETag(context.Background(), product)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if etagMatches(header, etag, false) {
+		return true
+	}
+	repository.RespondWithError(w, http.StatusPreconditionFailed, "Product has been modified")
+	return false
+}
+
+// checkIfNoneMatch answers 304 and returns true if the request has an
+// If-None-Match header that matches the product's current ETag, so a client
+// can revalidate a cached copy. It answers 500 and returns true if the ETag
+// cannot be derived.
+func checkIfNoneMatch(w http.ResponseWriter, r *http.Request, product models.Product) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	etag, err := productETag(context.Background(), product)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return true
+	}
+	if !etagMatches(header, etag, true) {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// respondWithProductChanged reports a write that lost a race with another
+// one: 412 if the client sent If-Match, 409 otherwise.
+func respondWithProductChanged(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		repository.RespondWithError(w, http.StatusPreconditionFailed, "Product has been modified")
+		return
+	}
+	repository.RespondWithError(w, http.StatusConflict, errProductChanged.Error())
+}
+
+// respondWithProduct writes a product together with its ETag.
+func respondWithProduct(w http.ResponseWriter, status int, product models.Product) {
+	// Bundle stock is computed from the components
+	ctx := context.Background()
+	products := []models.Product{product}
+	if err := setBundleStock(ctx, products); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	etag, err := productETag(ctx, product)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	repository.RespondWithJSON(w, status, products[0])
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/models"
+	"inventory/pagination"
+	"inventory/repository"
+	"inventory/xlsx"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushRows is how many rows are written between flushes to the client.
+const exportFlushRows = 500
+
+// defaultExportColumns match the import columns, so a CSV or JSON Lines
+// export can be imported again. attr.<name> columns are only exported when
+// requested.
+var defaultExportColumns = []string{
+	"id", "sku", "name", "slug", "barcode", "description", "price", "stock_level",
+	"weight", "length", "width", "height", "category_id", "category", "created_at", "updated_at",
+}
+
+var exportFormats = map[string]struct{ contentType, extension string }{
+	"csv":   {"text/csv", "csv"},
+	"jsonl": {"application/x-ndjson", "jsonl"},
+	"xlsx":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+}
+
+// exportWriter writes the rows of one export format.
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Flush() error
+	Close() error
+}
+
+// ExportProducts streams every product matching the GetProducts filters as
+// CSV, JSON Lines or XLSX. The columns parameter selects the columns.
+func ExportProducts(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	values := r.URL.Query()
+
+	format := values.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	outputFormat, ok := exportFormats[format]
+	if !ok {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid format, must be one of: csv, jsonl, xlsx")
+		return
+	}
+
+	columns, err := parseExportColumns(values)
+	if err != nil {
+		respondWithFilterError(w, err)
+		return
+	}
+
+	// Build the filter
+	filter, err := productFilter(ctx, values)
+	if err != nil {
+		respondWithFilterError(w, err)
+		return
+	}
+	sort, err := pagination.ParseSort(values.Get("sort"), productSortFields, defaultProductSort)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	categoryNames, err := loadCategoryNames(ctx)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Bundle stock is computed from the components
+	pipeline := append(productPipeline(filter), bson.D{{Key: "$sort", Value: sort.Keys()}})
+	cursor, err := productsCollection.Aggregate(ctx, pipeline, options.Aggregate().SetBatchSize(exportFlushRows))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// Errors after this point can only be logged, the response has started
+	w.Header().Set("Content-Type", outputFormat.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"products.%s\"", outputFormat.extension))
+	w.WriteHeader(http.StatusOK)
+
+	writer, err := newExportWriter(w, format, columns)
+	if err != nil {
+		log.Printf("Failed to start product export: %v", err)
+		return
+	}
+
+	rows := 0
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			log.Printf("Failed to decode exported product: %v", err)
+			return
+		}
+
+		row := make([]interface{}, len(columns))
+		for i, column := range columns {
+			row[i] = exportValue(product, column, categoryNames)
+		}
+		if err := writer.WriteRow(row); err != nil {
+			log.Printf("Failed to write product export: %v", err)
+			return
+		}
+
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := flushExport(w, writer); err != nil {
+				log.Printf("Failed to write product export: %v", err)
+				return
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Product export stopped after %d rows: %v", rows, err)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("Failed to finish product export: %v", err)
+	}
+}
+
+// parseExportColumns reads the columns parameter, rejecting unknown columns.
+func parseExportColumns(values url.Values) ([]string, error) {
+	requested := repository.ParseListParam(values, "columns")
+	if len(requested) == 0 {
+		return defaultExportColumns, nil
+	}
+
+	known := map[string]bool{}
+	for _, column := range defaultExportColumns {
+		known[column] = true
+	}
+
+	columns := []string{}
+	seen := map[string]bool{}
+	for _, column := range requested {
+		attribute, isAttribute := strings.CutPrefix(column, "attr.")
+		if !known[column] && (!isAttribute || attribute == "") {
+			return nil, filterError{fmt.Errorf("invalid column %s, must be attr.<name> or one of: %s", column, strings.Join(defaultExportColumns, ", "))}
+		}
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// loadCategoryNames maps every category ID to its name.
+func loadCategoryNames(ctx context.Context) (map[primitive.ObjectID]string, error) {
+	cursor, err := categoriesCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var categories []models.Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	names := make(map[primitive.ObjectID]string, len(categories))
+	for _, category := range categories {
+		names[category.ID] = category.Name
+	}
+	return names, nil
+}
+
+// exportValue returns the value of one column for a product, nil if empty.
+func exportValue(product models.Product, column string, categoryNames map[primitive.ObjectID]string) interface{} {
+	switch column {
+	case "id":
+		return product.ID.Hex()
+	case "sku":
+		return product.SKU
+	case "name":
+		return product.Name
+	case "slug":
+		return product.Slug
+	case "barcode":
+		return product.Barcode
+	case "description":
+		return product.Description
+	case "price":
+		return product.Price
+	case "stock_level":
+		return product.StockLevel
+	case "weight":
+		return product.Weight
+	case "length":
+		return product.Dimensions.Length
+	case "width":
+		return product.Dimensions.Width
+	case "height":
+		return product.Dimensions.Height
+	case "category_id":
+		return product.CategoryID.Hex()
+	case "category":
+		return categoryNames[product.CategoryID]
+	case "created_at":
+		return product.CreatedAt.UTC().Format(time.RFC3339)
+	case "updated_at":
+		return product.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	return product.Attributes[strings.TrimPrefix(column, "attr.")]
+}
+
+func newExportWriter(w io.Writer, format string, columns []string) (exportWriter, error) {
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+
+	switch format {
+	case "jsonl":
+		return &jsonlExportWriter{encoder: json.NewEncoder(w), columns: columns}, nil
+	case "xlsx":
+		writer, err := xlsx.NewWriter(w, "Products")
+		if err != nil {
+			return nil, err
+		}
+		return writer, writer.WriteRow(header)
+	default:
+		writer := &csvExportWriter{writer: csv.NewWriter(w)}
+		return writer, writer.WriteRow(header)
+	}
+}
+
+// flushExport pushes the rows written so far to the client.
+func flushExport(w http.ResponseWriter, writer exportWriter) error {
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			record[i] = v
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvExportWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvExportWriter) Close() error {
+	return c.Flush()
+}
+
+// jsonlExportWriter writes each row as an object keyed by column name, with
+// the dimension and attr.<name> columns nested under dimensions and
+// attributes as the JSON Lines import reads them.
+type jsonlExportWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+func (j *jsonlExportWriter) WriteRow(values []interface{}) error {
+	row := make(map[string]interface{}, len(values))
+	nested := func(key string) map[string]interface{} {
+		object, ok := row[key].(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{}
+			row[key] = object
+		}
+		return object
+	}
+	for i, value := range values {
+		column := j.columns[i]
+		switch {
+		case column == "length" || column == "width" || column == "height":
+			nested("dimensions")[column] = value
+		case strings.HasPrefix(column, "attr."):
+			if value != nil {
+				nested("attributes")[strings.TrimPrefix(column, "attr.")] = value
+			}
+		default:
+			row[column] = value
+		}
+	}
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonlExportWriter) Flush() error {
+	return nil
+}
+
+func (j *jsonlExportWriter) Close() error {
+	return nil
+}
@@ -3,11 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"inventory/models"
 	"inventory/repository"
 	"net/http"
+	"net/url"
 )
 
 func GetCategories(w http.ResponseWriter, r *http.Request) {
@@ -28,9 +32,53 @@ func GetCategories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Add product counts
+	counts, err := categoryProductCounts(ctx)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range categories {
+		categories[i].ProductCount = counts[categories[i].ID]
+	}
+
 	repository.RespondWithJSON(w, http.StatusOK, categories)
 }
 
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Convert string ID to ObjectID
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	// Find category by ID
+	var category models.Category
+	err = categoriesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Add product count
+	category.ProductCount, err = productsCollection.CountDocuments(ctx, notDeleted(bson.M{"category_id": id}))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, category)
+}
+
 func CreateCategory(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	var category models.Category
@@ -45,6 +93,10 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 		repository.RespondWithError(w, http.StatusBadRequest, "Category name is required")
 		return
 	}
+	if err := validateAttributeSchema(category.Attributes); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Check if category name already exists
 	count, err := categoriesCollection.CountDocuments(ctx, bson.M{"name": category.Name})
@@ -57,9 +109,31 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Resolve the ancestors from the parent category
+	category.Ancestors = []primitive.ObjectID{}
+	if category.ParentID != nil {
+		var parent models.Category
+		err = categoriesCollection.FindOne(ctx, bson.M{"_id": *category.ParentID}).Decode(&parent)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				repository.RespondWithError(w, http.StatusBadRequest, "Parent category not found")
+				return
+			}
+			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		category.Ancestors = append(parent.Ancestors, parent.ID)
+	}
+
 	// Create new category with new ID
 	category.ID = primitive.NewObjectID()
 
+	category.Slug, err = resolveSlug(ctx, categoriesCollection, category.Slug, category.Name, category.ID, nil)
+	if err != nil {
+		respondWithSlugError(w, err)
+		return
+	}
+
 	// Insert category
 	_, err = categoriesCollection.InsertOne(ctx, category)
 	if err != nil {
@@ -69,3 +143,107 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 
 	repository.RespondWithJSON(w, http.StatusCreated, category)
 }
+
+// GetCategoryBySlug finds a category by its slug, redirecting requests for
+// a slug the category had before it was renamed.
+func GetCategoryBySlug(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+
+	var category models.Category
+	moved, err := findBySlug(ctx, categoriesCollection, vars["slug"], &category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if moved {
+		http.Redirect(w, r, "/categories/by-slug/"+url.PathEscape(category.Slug), http.StatusMovedPermanently)
+		return
+	}
+
+	// Add product count
+	category.ProductCount, err = productsCollection.CountDocuments(ctx, notDeleted(bson.M{"category_id": category.ID}))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, category)
+}
+
+// GetCategoryTree returns all categories nested under their parents.
+func GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	// Query categories
+	cursor, err := categoriesCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var categories []models.Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	counts, err := categoryProductCounts(ctx)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Index the nodes, then attach each to its parent
+	nodes := make(map[primitive.ObjectID]*models.CategoryNode, len(categories))
+	for _, category := range categories {
+		category.ProductCount = counts[category.ID]
+		nodes[category.ID] = &models.CategoryNode{Category: category, Children: []*models.CategoryNode{}}
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, roots)
+}
+
+// categoryProductCounts returns the number of products in each category,
+// not counting deleted ones.
+func categoryProductCounts(ctx context.Context) (map[primitive.ObjectID]int64, error) {
+	cursor, err := productsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{})}},
+		{{Key: "$group", Value: bson.M{"_id": "$category_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]int64, len(results))
+	for _, result := range results {
+		counts[result.ID] = result.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"inventory/models"
+	"inventory/repository"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var defaultPriceBuckets = []float64{0, 25, 50, 100, 250, 500, 1000}
+
+// GetProductFacets counts the products matching the list filters per
+// category, per price bucket and by stock availability, in one aggregation.
+// Bundles are counted by the stock their components allow.
+func GetProductFacets(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	filter, err := productFilter(ctx, r.URL.Query())
+	if err != nil {
+		respondWithFilterError(w, err)
+		return
+	}
+
+	buckets, err := parsePriceBuckets(r.URL.Query())
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The top bucket is open-ended
+	boundaries := append(append([]float64{}, buckets...), math.MaxFloat64)
+
+	pipeline := append(productPipeline(filter), bson.D{
+		{Key: "$facet", Value: bson.M{
+			"categories": bson.A{
+				bson.M{"$group": bson.M{"_id": "$category_id", "count": bson.M{"$sum": 1}}},
+				bson.M{"$lookup": bson.M{"from": "categories", "localField": "_id", "foreignField": "_id", "as": "category"}},
+				bson.M{"$project": bson.M{"count": 1, "name": bson.M{"$ifNull": bson.A{bson.M{"$first": "$category.name"}, ""}}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "name", Value: 1}}},
+			},
+			"prices": bson.A{
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price",
+					"boundaries": boundaries,
+					"default":    "other",
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+			"stock": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"$gt": bson.A{"$stock_level", 0}},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+		}},
+	})
+
+	cursor, err := productsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Categories []models.CategoryFacet `bson:"categories"`
+		Prices     []struct {
+			ID    interface{} `bson:"_id"`
+			Count int64       `bson:"count"`
+		} `bson:"prices"`
+		Stock []struct {
+			InStock bool  `bson:"_id"`
+			Count   int64 `bson:"count"`
+		} `bson:"stock"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	facets := models.ProductFacets{Categories: []models.CategoryFacet{}, Prices: []models.PriceFacet{}}
+	if len(results) > 0 {
+		result := results[0]
+		if result.Categories != nil {
+			facets.Categories = result.Categories
+		}
+
+		// Report every bucket, including empty ones
+		counts := map[float64]int64{}
+		for _, bucket := range result.Prices {
+			if lower, ok := bucket.ID.(float64); ok {
+				counts[lower] = bucket.Count
+			}
+		}
+		for i, lower := range buckets {
+			facet := models.PriceFacet{Min: lower, Count: counts[lower]}
+			if i+1 < len(buckets) {
+				facet.Max = &buckets[i+1]
+			}
+			facets.Prices = append(facets.Prices, facet)
+		}
+
+		for _, stock := range result.Stock {
+			if stock.InStock {
+				facets.Stock.InStock = stock.Count
+			} else {
+				facets.Stock.OutOfStock = stock.Count
+			}
+		}
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, facets)
+}
+
+// parsePriceBuckets reads the lower bounds of the price buckets from the
+// price_buckets parameter, e.g. price_buckets=0,50,100. A bucket from 0 is
+// added in front if the first bound is higher.
+func parsePriceBuckets(values url.Values) ([]float64, error) {
+	list := repository.ParseListParam(values, "price_buckets")
+	if len(list) == 0 {
+		return defaultPriceBuckets, nil
+	}
+
+	buckets := make([]float64, len(list))
+	for i, item := range list {
+		bound, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price bucket: %s", item)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return nil, fmt.Errorf("price buckets must be in ascending order")
+		}
+		buckets[i] = bound
+	}
+
+	// Cheaper products get a bucket of their own, so every product is counted
+	if buckets[0] > 0 {
+		buckets = append([]float64{0}, buckets...)
+	}
+	return buckets, nil
+}
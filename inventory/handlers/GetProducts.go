@@ -6,70 +6,44 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"inventory/models"
+	"inventory/pagination"
 	"inventory/repository"
 	"net/http"
-	"strconv"
+	"net/url"
 )
 
 func GetProducts(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 
-	// Get query parameters for filtering and pagination
-	category := r.URL.Query().Get("category")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-
-	// Default values
-	limit := 10
-	offset := 0
-
-	if limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
-	}
-
-	if offsetStr != "" {
-		parsedOffset, err := strconv.Atoi(offsetStr)
-		if err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
-	}
-
 	// Build the filter
-	filter := bson.M{}
-
-	if category != "" {
-		// First find the category ID
-		var categoryDoc models.Category
-		err := categoriesCollection.FindOne(ctx, bson.M{"name": primitive.Regex{Pattern: category, Options: "i"}}).Decode(&categoryDoc)
-		if err == nil {
-			filter["category_id"] = categoryDoc.ID
-		}
+	filter, err := productFilter(ctx, r.URL.Query())
+	if err != nil {
+		respondWithFilterError(w, err)
+		return
 	}
 
-	// Set up options for pagination
-	options := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{{Key: "created_at", Value: -1}})
-
-	// Query products
-	cursor, err := productsCollection.Find(ctx, filter, options)
+	// Sorting and pagination
+	sort, err := pagination.ParseSort(r.URL.Query().Get("sort"), productSortFields, defaultProductSort)
 	if err != nil {
-		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, err := pagination.ParseQuery(r.URL.Query(), sort)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer cursor.Close(ctx)
 
-	// Decode results
+	// Query products, with bundle stock computed from the components
 	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
+	page, err := pagination.Aggregate(ctx, productsCollection, productPipeline(filter), query, &products)
+	if err != nil {
 		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	repository.RespondWithJSON(w, http.StatusOK, products)
+	repository.RespondWithJSON(w, http.StatusOK, pagination.NewResponse(r, products, page))
 }
 
 func GetProduct(w http.ResponseWriter, r *http.Request) {
@@ -84,9 +58,48 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Deleted products are only shown with include_deleted
+	withDeleted, err := includeDeleted(r.URL.Query())
+	if err != nil {
+		respondWithFilterError(w, err)
+		return
+	}
+	filter := bson.M{"_id": id}
+	if !withDeleted {
+		notDeleted(filter)
+	}
+
 	// Find product by ID
 	var product models.Product
-	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+	err = productsCollection.FindOne(ctx, filter).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Let clients revalidate a cached copy
+	if checkIfNoneMatch(w, r, product) {
+		return
+	}
+
+	respondWithProduct(w, http.StatusOK, product)
+}
+
+// GetProductBySlug finds a product by its slug, redirecting requests for a
+// slug the product had before it was renamed.
+func GetProductBySlug(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+
+	var product models.Product
+	moved, err := findBySlug(ctx, productsCollection, vars["slug"], &product)
+	if err == nil && product.DeletedAt != nil {
+		err = mongo.ErrNoDocuments
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
@@ -95,6 +108,15 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if moved {
+		http.Redirect(w, r, "/products/by-slug/"+url.PathEscape(product.Slug), http.StatusMovedPermanently)
+		return
+	}
+
+	// Let clients revalidate a cached copy
+	if checkIfNoneMatch(w, r, product) {
+		return
+	}
 
-	repository.RespondWithJSON(w, http.StatusOK, product)
+	respondWithProduct(w, http.StatusOK, product)
 }
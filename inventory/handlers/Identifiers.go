@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/gtin"
+	"inventory/models"
+	"inventory/repository"
+	"net/http"
+	"regexp"
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// identifierError reports an invalid or duplicate SKU or barcode.
+type identifierError struct {
+	field   string
+	status  int
+	message string
+}
+
+func (e identifierError) Error() string {
+	return e.message
+}
+
+func respondWithIdentifierError(w http.ResponseWriter, err error) {
+	if ie, ok := err.(identifierError); ok {
+		repository.RespondWithError(w, ie.status, ie.message)
+		return
+	}
+	repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+// checkIdentifiers validates the SKUs and barcodes of a product and its
+// variants and makes sure no other product uses them. SKUs and barcodes are
+// unique across products and variants alike.
+func checkIdentifiers(ctx context.Context, product models.Product) error {
+	skus := map[string]bool{}
+	barcodes := map[string]bool{}
+
+	check := func(sku, barcode string) error {
+		if sku != "" {
+			if !skuPattern.MatchString(sku) {
+				return identifierError{"sku", http.StatusBadRequest, fmt.Sprintf("Invalid SKU %q", sku)}
+			}
+			if skus[sku] {
+				return identifierError{"sku", http.StatusBadRequest, fmt.Sprintf("Duplicate SKU %s", sku)}
+			}
+			skus[sku] = true
+		}
+		if barcode != "" {
+			if !gtin.Valid(barcode) {
+				return identifierError{"barcode", http.StatusBadRequest, fmt.Sprintf("Invalid barcode %s: must be a GTIN-8, 12, 13 or 14 with a valid check digit", barcode)}
+			}
+			if barcodes[barcode] {
+				return identifierError{"barcode", http.StatusBadRequest, fmt.Sprintf("Duplicate barcode %s", barcode)}
+			}
+			barcodes[barcode] = true
+		}
+		return nil
+	}
+
+	if err := check(product.SKU, product.Barcode); err != nil {
+		return err
+	}
+	for _, variant := range product.Variants {
+		if err := check(variant.SKU, variant.Barcode); err != nil {
+			return err
+		}
+	}
+
+	for field, values := range map[string]map[string]bool{"sku": skus, "barcode": barcodes} {
+		if len(values) == 0 {
+			continue
+		}
+		list := make([]string, 0, len(values))
+		for value := range values {
+			list = append(list, value)
+		}
+
+		var other models.Product
+		err := productsCollection.FindOne(ctx, bson.M{
+			"_id": bson.M{"$ne": product.ID},
+			"$or": []bson.M{{field: bson.M{"$in": list}}, {"variants." + field: bson.M{"$in": list}}},
+		}).Decode(&other)
+		if err == nil {
+			return identifierError{field, http.StatusConflict, fmt.Sprintf("A %s is already used by product %s", field, other.ID.Hex())}
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	return nil
+}
+
+// findByIdentifier finds the product that has value as its own or one of its
+// variants' SKU or barcode, returning the matched variant if any.
+func findByIdentifier(ctx context.Context, field, value string) (models.Product, *models.ProductVariant, error) {
+	var product models.Product
+	err := productsCollection.FindOne(ctx, notDeleted(bson.M{
+		"$or": []bson.M{{field: value}, {"variants." + field: value}},
+	})).Decode(&product)
+	if err != nil {
+		return product, nil, err
+	}
+
+	for i, variant := range product.Variants {
+		if (field == "sku" && variant.SKU == value) || (field == "barcode" && variant.Barcode == value) {
+			return product, &product.Variants[i], nil
+		}
+	}
+	return product, nil, nil
+}
+
+// ProductLookup is returned by the SKU and barcode lookups.
+type ProductLookup struct {
+	Product   models.Product      `json:"product"`
+	VariantID *primitive.ObjectID `json:"variant_id,omitempty"`
+}
+
+func GetProductBySKU(w http.ResponseWriter, r *http.Request) {
+	getProductByIdentifier(w, r, "sku", mux.Vars(r)["sku"])
+}
+
+func GetProductByBarcode(w http.ResponseWriter, r *http.Request) {
+	getProductByIdentifier(w, r, "barcode", mux.Vars(r)["barcode"])
+}
+
+func getProductByIdentifier(w http.ResponseWriter, r *http.Request, field, value string) {
+	product, variant, err := findByIdentifier(context.Background(), field, value)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Let clients revalidate a cached copy
+	if checkIfNoneMatch(w, r, product) {
+		return
+	}
+
+	// Bundle stock is computed from the components
+	products := []models.Product{product}
+	if err := setBundleStock(context.Background(), products); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	etag, err := productETag(context.Background(), product)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	lookup := ProductLookup{Product: products[0]}
+	if variant != nil {
+		lookup.VariantID = &variant.ID
+	}
+	w.Header().Set("ETag", etag)
+	repository.RespondWithJSON(w, http.StatusOK, lookup)
+}
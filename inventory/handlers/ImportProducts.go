@@ -0,0 +1,626 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/jsonpatch"
+	"inventory/models"
+	"inventory/repository"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxImportSize = 50 << 20
+	maxImportLineSize    = 1 << 20
+
+	// importProgressInterval is how many rows are imported between progress
+	// updates of the job.
+	importProgressInterval = 100
+)
+
+// maxImportSize is the largest accepted import file in bytes, from
+// MAX_IMPORT_SIZE.
+var maxImportSize = func() int64 {
+	size, err := strconv.ParseInt(getEnvOrDefault("MAX_IMPORT_SIZE", strconv.Itoa(defaultMaxImportSize)), 10, 64)
+	if err != nil || size <= 0 {
+		log.Printf("Invalid MAX_IMPORT_SIZE, using %d bytes", defaultMaxImportSize)
+		return defaultMaxImportSize
+	}
+	return size
+}()
+
+// importFormats maps the accepted content types to import formats.
+var importFormats = map[string]string{
+	"text/csv":                "csv",
+	"application/x-ndjson":    "jsonl",
+	"application/jsonl":       "jsonl",
+	"application/x-jsonlines": "jsonl",
+}
+
+// importProductRequest is one imported product. Category names a category
+// by name or slug as an alternative to category_id.
+type importProductRequest struct {
+	models.CreateProductRequest
+	Category string `json:"category"`
+
+	// csvAttributes holds the attr.<name> columns of a CSV row until the
+	// category schema tells their types
+	csvAttributes map[string]string
+
+	// patch holds the fields the row gives, as a merge patch. Updates of
+	// existing products only write these.
+	patch map[string]interface{}
+}
+
+// importPatchFields are the editable product fields an import can update.
+var importPatchFields = map[string]bool{
+	"name": true, "slug": true, "sku": true, "barcode": true, "description": true,
+	"price": true, "stock_level": true, "weight": true, "dimensions": true, "attributes": true,
+}
+
+// importRecord is one row read from an import file.
+type importRecord struct {
+	Row     int
+	Request importProductRequest
+	Err     error
+}
+
+// ImportProducts accepts a CSV or JSON Lines file of products and imports it
+// in the background, creating products with new SKUs and updating those
+// whose SKU exists. The format comes from the format query parameter or the
+// Content-Type. The response is the job to poll for progress.
+func ImportProducts(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format = importFormats[mediaType]
+	}
+	if format != "csv" && format != "jsonl" {
+		repository.RespondWithError(w, http.StatusUnsupportedMediaType, "Import must be CSV (text/csv) or JSON Lines (application/x-ndjson)")
+		return
+	}
+
+	job := models.ImportJob{
+		ID:        primitive.NewObjectID(),
+		Format:    format,
+		Status:    "queued",
+		CreatedAt: time.Now(),
+	}
+
+	// Keep the file in GridFS until the job has read it
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := importsBucket.UploadFromStreamWithID(job.ID, "import."+format, r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			repository.RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Import must not exceed %d bytes", maxImportSize))
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := importJobsCollection.InsertOne(ctx, job); err != nil {
+		if deleteErr := importsBucket.DeleteContext(ctx, job.ID); deleteErr != nil {
+			log.Printf("Failed to delete import file %s: %v", job.ID.Hex(), deleteErr)
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go runImport(job)
+
+	w.Header().Set("Location", "/products/import/"+job.ID.Hex())
+	repository.RespondWithJSON(w, http.StatusAccepted, job)
+}
+
+func GetImportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := findImportJob(w, r)
+	if !ok {
+		return
+	}
+	repository.RespondWithJSON(w, http.StatusOK, job)
+}
+
+// GetImportErrors downloads the rows a finished import rejected as CSV.
+func GetImportErrors(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	job, ok := findImportJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != "completed" && job.Status != "failed" {
+		repository.RespondWithError(w, http.StatusConflict, "Import has not finished yet")
+		return
+	}
+
+	cursor, err := importErrorsCollection.Find(ctx, bson.M{"job_id": job.ID}, options.Find().SetSort(bson.D{{Key: "row", Value: 1}}))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"import-%s-errors.csv\"", job.ID.Hex()))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"row", "sku", "message"})
+	for cursor.Next(ctx) {
+		var rowError models.ImportRowError
+		if err := cursor.Decode(&rowError); err != nil {
+			log.Printf("Failed to decode error of import %s: %v", job.ID.Hex(), err)
+			return
+		}
+		writer.Write([]string{strconv.Itoa(rowError.Row), rowError.SKU, rowError.Message})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Failed to write errors of import %s: %v", job.ID.Hex(), err)
+	}
+}
+
+func findImportJob(w http.ResponseWriter, r *http.Request) (models.ImportJob, bool) {
+	var job models.ImportJob
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["job_id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid import ID")
+		return job, false
+	}
+
+	err = importJobsCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Import not found")
+			return job, false
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return job, false
+	}
+	return job, true
+}
+
+// runImport imports every row of the job's file, recording rejected rows,
+// and removes the file when done.
+func runImport(job models.ImportJob) {
+	ctx := context.Background()
+	defer func() {
+		if err := importsBucket.DeleteContext(ctx, job.ID); err != nil {
+			log.Printf("Failed to delete import file %s: %v", job.ID.Hex(), err)
+		}
+	}()
+
+	now := time.Now()
+	job.Status = "running"
+	job.StartedAt = &now
+
+	// Count the rows first so progress can be told as a fraction
+	err := readImportRecords(ctx, job, func(record importRecord) error {
+		job.TotalRows++
+		return nil
+	})
+	if err != nil {
+		finishImport(ctx, job, err)
+		return
+	}
+	saveImportJob(ctx, job)
+
+	importer := &productImporter{categories: map[string]models.Category{}}
+	err = readImportRecords(ctx, job, func(record importRecord) error {
+		created, err := importer.importRecord(ctx, record)
+		job.ProcessedRows++
+		switch {
+		case err != nil:
+			job.Failed++
+			_, err = importErrorsCollection.InsertOne(ctx, models.ImportRowError{
+				JobID:   job.ID,
+				Row:     record.Row,
+				SKU:     record.Request.SKU,
+				Message: err.Error(),
+			})
+			if err != nil {
+				return err
+			}
+		case created:
+			job.Created++
+		default:
+			job.Updated++
+		}
+
+		if job.ProcessedRows%importProgressInterval == 0 {
+			saveImportJob(ctx, job)
+		}
+		return nil
+	})
+	finishImport(ctx, job, err)
+}
+
+func finishImport(ctx context.Context, job models.ImportJob, err error) {
+	now := time.Now()
+	job.Status = "completed"
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+	}
+	saveImportJob(ctx, job)
+}
+
+func saveImportJob(ctx context.Context, job models.ImportJob) {
+	if _, err := importJobsCollection.ReplaceOne(ctx, bson.M{"_id": job.ID}, job); err != nil {
+		log.Printf("Failed to save import %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// readImportRecords calls fn for every row of the job's file. Rows that
+// cannot be parsed are passed on with Err set; an error reading the file as
+// a whole stops the import.
+func readImportRecords(ctx context.Context, job models.ImportJob, fn func(importRecord) error) error {
+	stream, err := importsBucket.OpenDownloadStream(job.ID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if job.Format == "csv" {
+		return readCSVRecords(stream, fn)
+	}
+	return readJSONLRecords(stream, fn)
+}
+
+// readCSVRecords reads a CSV file with a header row naming the columns:
+// sku, name, slug, barcode, description, price, stock_level, weight,
+// length, width, height, category_id or category, and attr.<name> for each
+// attribute. Other columns are ignored.
+func readCSVRecords(r io.Reader, fn func(importRecord) error) error {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid CSV header: %w", err)
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := fn(importRecord{Row: parseErr.StartLine, Err: parseErr.Err}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		row, _ := reader.FieldPos(0)
+		fields := map[string]string{}
+		for i, name := range header {
+			fields[name] = values[i]
+		}
+		request, err := csvProductRequest(fields)
+		if err := fn(importRecord{Row: row, Request: request, Err: err}); err != nil {
+			return err
+		}
+	}
+}
+
+// csvProductRequest converts the columns of a CSV row to a request.
+func csvProductRequest(fields map[string]string) (importProductRequest, error) {
+	var req importProductRequest
+	field := func(name string) string {
+		return strings.TrimSpace(fields[name])
+	}
+
+	req.SKU = field("sku")
+	req.Name = field("name")
+	req.Slug = field("slug")
+	req.Barcode = field("barcode")
+	req.Description = fields["description"]
+	req.CategoryID = field("category_id")
+	req.Category = field("category")
+
+	numbers := map[string]*float64{
+		"price":  &req.Price,
+		"weight": &req.Weight,
+		"length": &req.Dimensions.Length,
+		"width":  &req.Dimensions.Width,
+		"height": &req.Dimensions.Height,
+	}
+	for name, target := range numbers {
+		if value := field(name); value != "" {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return req, fmt.Errorf("Invalid %s %q", name, value)
+			}
+			*target = number
+		}
+	}
+	if value := field("stock_level"); value != "" {
+		stockLevel, err := strconv.Atoi(value)
+		if err != nil {
+			return req, fmt.Errorf("Invalid stock_level %q", value)
+		}
+		req.StockLevel = stockLevel
+	}
+
+	// Only the columns in the file are written to existing products, and
+	// blank numbers leave the current value alone
+	req.patch = map[string]interface{}{}
+	dimensions := map[string]interface{}{}
+	attributes := map[string]interface{}{}
+	for name, value := range fields {
+		if _, number := numbers[name]; (number || name == "stock_level") && field(name) == "" {
+			continue
+		}
+
+		switch name {
+		case "sku", "name", "slug", "barcode":
+			req.patch[name] = field(name)
+		case "description":
+			req.patch[name] = value
+		case "price", "weight":
+			req.patch[name] = *numbers[name]
+		case "stock_level":
+			req.patch[name] = float64(req.StockLevel)
+		case "length", "width", "height":
+			dimensions[name] = *numbers[name]
+		}
+
+		// An empty attribute removes it, its value is typed later
+		if attribute, ok := strings.CutPrefix(name, "attr."); ok {
+			attributes[attribute] = nil
+			if strings.TrimSpace(value) != "" {
+				if req.csvAttributes == nil {
+					req.csvAttributes = map[string]string{}
+				}
+				req.csvAttributes[attribute] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if len(dimensions) > 0 {
+		req.patch["dimensions"] = dimensions
+	}
+	if len(attributes) > 0 {
+		req.patch["attributes"] = attributes
+	}
+	return req, nil
+}
+
+// readJSONLRecords reads one JSON product per line, in the format of
+// CreateProduct plus an optional category name or slug. Blank lines are
+// skipped.
+func readJSONLRecords(r io.Reader, fn func(importRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var req importProductRequest
+		err := json.Unmarshal(line, &req)
+		if err == nil {
+			err = json.Unmarshal(line, &req.patch)
+		}
+		for name := range req.patch {
+			if !importPatchFields[name] {
+				delete(req.patch, name)
+			}
+		}
+		if err := fn(importRecord{Row: row, Request: req, Err: err}); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return fmt.Errorf("line %d is longer than %d bytes", row+1, maxImportLineSize)
+		}
+		return err
+	}
+	return nil
+}
+
+// productImporter imports rows, caching the categories they name.
+type productImporter struct {
+	categories map[string]models.Category
+}
+
+// importRecord creates or updates the product of one row, reporting whether
+// it was created. Rows are validated like CreateProduct requests.
+func (im *productImporter) importRecord(ctx context.Context, record importRecord) (bool, error) {
+	if record.Err != nil {
+		return false, record.Err
+	}
+	req := record.Request
+	if req.SKU == "" {
+		return false, productError{http.StatusBadRequest, "SKU is required to import a product"}
+	}
+
+	var existingProduct models.Product
+	err := productsCollection.FindOne(ctx, bson.M{"sku": req.SKU}).Decode(&existingProduct)
+	exists := err == nil
+	if err != nil && err != mongo.ErrNoDocuments {
+		return false, err
+	}
+	if exists && existingProduct.DeletedAt != nil {
+		return false, productError{http.StatusConflict, fmt.Sprintf("SKU %s belongs to a deleted product", req.SKU)}
+	}
+
+	if req.patch == nil {
+		req.patch = map[string]interface{}{}
+	}
+
+	// Existing products stay in their category unless the row names one
+	var category models.Category
+	if !exists || req.CategoryID != "" || req.Category != "" {
+		category, err = im.category(ctx, req)
+		if err != nil {
+			return false, err
+		}
+		req.CategoryID = category.ID.Hex()
+		req.patch["category_id"] = req.CategoryID
+	} else if req.csvAttributes != nil {
+		current := importProductRequest{}
+		current.CategoryID = existingProduct.CategoryID.Hex()
+		category, err = im.category(ctx, current)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// CSV attribute values are typed by the category schema
+	if req.csvAttributes != nil {
+		req.Attributes, err = csvAttributes(ctx, category, req.csvAttributes)
+		if err != nil {
+			return false, err
+		}
+		patchAttributes := req.patch["attributes"].(map[string]interface{})
+		for name, value := range req.Attributes {
+			patchAttributes[name] = value
+		}
+	}
+
+	if !exists {
+		product, err := buildProduct(ctx, req.CreateProductRequest, primitive.NewObjectID(), nil)
+		if err != nil {
+			return false, err
+		}
+		_, err = productsCollection.InsertOne(ctx, product)
+		return err == nil, err
+	}
+	return false, updateImportedProduct(ctx, existingProduct, req)
+}
+
+// category finds the row's category by ID, or else by name or slug.
+func (im *productImporter) category(ctx context.Context, req importProductRequest) (models.Category, error) {
+	var filter bson.M
+	key := req.CategoryID
+	switch {
+	case req.CategoryID != "":
+		id, err := primitive.ObjectIDFromHex(req.CategoryID)
+		if err != nil {
+			return models.Category{}, productError{http.StatusBadRequest, "Invalid category ID"}
+		}
+		filter = bson.M{"_id": id}
+	case req.Category != "":
+		key = "name:" + req.Category
+		filter = bson.M{"$or": []bson.M{
+			{"slug": req.Category},
+			{"name": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(req.Category) + "$", Options: "i"}},
+		}}
+	default:
+		return models.Category{}, productError{http.StatusBadRequest, "Category is required"}
+	}
+
+	if category, ok := im.categories[key]; ok {
+		return category, nil
+	}
+
+	var category models.Category
+	err := categoriesCollection.FindOne(ctx, filter).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return category, productError{http.StatusBadRequest, "Category not found"}
+		}
+		return category, err
+	}
+	im.categories[key] = category
+	return category, nil
+}
+
+// csvAttributes converts CSV attribute values to the types of the category
+// schema. Attributes the schema does not know stay strings and are rejected
+// by validation.
+func csvAttributes(ctx context.Context, category models.Category, values map[string]string) (map[string]interface{}, error) {
+	schema, err := categorySchema(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]string{}
+	for _, definition := range schema {
+		types[definition.Name] = definition.Type
+	}
+
+	attributes := map[string]interface{}{}
+	for name, value := range values {
+		switch types[name] {
+		case models.AttributeNumber:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, attributeError{fmt.Errorf("Attribute %s must be a number", name)}
+			}
+			attributes[name] = number
+		case models.AttributeBoolean:
+			boolean, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, attributeError{fmt.Errorf("Attribute %s must be a boolean", name)}
+			}
+			attributes[name] = boolean
+		default:
+			attributes[name] = value
+		}
+	}
+	return attributes, nil
+}
+
+// updateImportedProduct writes the fields an imported row gives over those
+// of an existing product, like a merge patch. Options and variants are not
+// imported for existing products, and the stock of a product with variants
+// stays theirs.
+func updateImportedProduct(ctx context.Context, existingProduct models.Product, req importProductRequest) error {
+	if len(req.Options) > 0 || len(req.Variants) > 0 {
+		return productError{http.StatusBadRequest, "Options and variants of existing products cannot be imported"}
+	}
+	if existingProduct.Type == models.ProductTypeBundle {
+		return productError{http.StatusBadRequest, "Bundles cannot be updated by import"}
+	}
+
+	patch := req.patch
+	if len(existingProduct.Variants) > 0 {
+		delete(patch, "stock_level")
+	}
+	doc, errs := decodeProductDocument(jsonpatch.Merge(newProductDocument(existingProduct), patch), existingProduct)
+	if len(errs) > 0 {
+		return fieldErrors(errs)
+	}
+
+	_, err := applyProductDocument(ctx, existingProduct, doc, "import")
+	return err
+}
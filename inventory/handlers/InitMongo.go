@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -19,6 +20,15 @@ var (
 	productsCollection   *mongo.Collection
 	ordersCollection     *mongo.Collection
 	categoriesCollection *mongo.Collection
+	countersCollection   *mongo.Collection
+	imagesBucket         *gridfs.Bucket
+
+	priceHistoryCollection    *mongo.Collection
+	scheduledPricesCollection *mongo.Collection
+
+	importJobsCollection   *mongo.Collection
+	importErrorsCollection *mongo.Collection
+	importsBucket          *gridfs.Bucket
 )
 
 func InitMongo(ctx context.Context) {
@@ -51,6 +61,23 @@ func InitMongo(ctx context.Context) {
 	productsCollection = db.Collection("products")
 	categoriesCollection = db.Collection("categories")
 	ordersCollection = db.Collection("orders")
+	countersCollection = db.Collection("counters")
+	priceHistoryCollection = db.Collection("price_history")
+	scheduledPricesCollection = db.Collection("scheduled_prices")
+	importJobsCollection = db.Collection("import_jobs")
+	importErrorsCollection = db.Collection("import_errors")
+
+	// Product images are stored in GridFS
+	imagesBucket, err = gridfs.NewBucket(db, options.GridFSBucket().SetName("product_images"))
+	if err != nil {
+		log.Fatalf("Failed to create product images bucket: %v", err)
+	}
+
+	// Import files wait in GridFS until their job has read them
+	importsBucket, err = gridfs.NewBucket(db, options.GridFSBucket().SetName("product_imports"))
+	if err != nil {
+		log.Fatalf("Failed to create product imports bucket: %v", err)
+	}
 
 	// Create indexes
 	_, err = productsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
@@ -61,6 +88,40 @@ func InitMongo(ctx context.Context) {
 		log.Printf("Failed to create index on products collection: %v", err)
 	}
 
+	_, err = productsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create pagination index on products collection: %v", err)
+	}
+
+	_, err = productsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "category_id", Value: 1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create category index on products collection: %v", err)
+	}
+
+	_, err = productsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().
+			SetName("product_text").
+			SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "description", Value: 2}}),
+	})
+	if err != nil {
+		log.Printf("Failed to create text index on products collection: %v", err)
+	}
+
+	_, err = productsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		log.Printf("Failed to create deleted_at index on products collection: %v", err)
+	}
+
 	_, err = categoriesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "name", Value: 1}},
 		Options: options.Index().SetUnique(true),
@@ -69,6 +130,43 @@ func InitMongo(ctx context.Context) {
 		log.Printf("Failed to create index on categories collection: %v", err)
 	}
 
+	_, err = categoriesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ancestors", Value: 1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create ancestors index on categories collection: %v", err)
+	}
+
+	// SKUs and barcodes are optional, so only non-empty values must be unique
+	for _, field := range []string{"sku", "barcode", "variants.sku", "variants.barcode"} {
+		_, err = productsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}}),
+		})
+		if err != nil {
+			log.Printf("Failed to create %s index on products collection: %v", field, err)
+		}
+	}
+
+	for _, collection := range []*mongo.Collection{productsCollection, categoriesCollection} {
+		_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "slug", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+			},
+			{
+				Keys:    bson.D{{Key: "old_slugs", Value: 1}},
+				Options: options.Index().SetUnique(false),
+			},
+		})
+		if err != nil {
+			log.Printf("Failed to create slug indexes on %s collection: %v", collection.Name(), err)
+		}
+	}
+
 	_, err = ordersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "user_id", Value: 1}},
 		Options: options.Index().SetUnique(false),
@@ -77,6 +175,79 @@ func InitMongo(ctx context.Context) {
 		log.Printf("Failed to create index on orders collection: %v", err)
 	}
 
+	_, err = ordersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "number", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"number": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		log.Printf("Failed to create order number index on orders collection: %v", err)
+	}
+
+	_, err = ordersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "items.product_id", Value: 1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create product index on orders collection: %v", err)
+	}
+
+	_, err = ordersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "items.components.product_id", Value: 1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create bundle component index on orders collection: %v", err)
+	}
+
+	_, err = priceHistoryCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "changed_at", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create index on price_history collection: %v", err)
+	}
+
+	_, err = scheduledPricesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "starts_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "starts_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "ends_at", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Failed to create indexes on scheduled_prices collection: %v", err)
+	}
+
+	_, err = importErrorsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "job_id", Value: 1}, {Key: "row", Value: 1}},
+		Options: options.Index().SetUnique(false),
+	})
+	if err != nil {
+		log.Printf("Failed to create index on import_errors collection: %v", err)
+	}
+
+	// Imports run in this process, so unfinished ones were cut short by a restart
+	_, err = importJobsCollection.UpdateMany(
+		ctx,
+		bson.M{"status": bson.M{"$in": bson.A{"queued", "running"}}},
+		bson.M{"$set": bson.M{"status": "failed", "error": "Interrupted by a restart", "finished_at": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to fail interrupted imports: %v", err)
+	}
+
+	// Give documents created before slugs existed one
+	for _, collection := range []*mongo.Collection{productsCollection, categoriesCollection} {
+		if err := backfillSlugs(ctx, collection); err != nil {
+			log.Printf("Failed to backfill slugs in %s collection: %v", collection.Name(), err)
+		}
+	}
+
+	// Give products created before versioning a version to compare against
+	_, err = productsCollection.UpdateMany(ctx, bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 1}})
+	if err != nil {
+		log.Printf("Failed to backfill product versions: %v", err)
+	}
+
 	// Insert sample data if collections are empty
 	count, err := categoriesCollection.CountDocuments(ctx, bson.M{})
 	if err != nil {
@@ -88,13 +259,17 @@ func InitMongo(ctx context.Context) {
 		electronicsCategory := models.Category{
 			ID:          primitive.NewObjectID(),
 			Name:        "Electronics",
+			Slug:        "electronics",
 			Description: "Electronic devices and accessories",
+			Ancestors:   []primitive.ObjectID{},
 		}
 
 		clothingCategory := models.Category{
 			ID:          primitive.NewObjectID(),
 			Name:        "Clothing",
+			Slug:        "clothing",
 			Description: "Apparel and fashion items",
+			Ancestors:   []primitive.ObjectID{},
 		}
 
 		_, err = categoriesCollection.InsertOne(ctx, electronicsCategory)
@@ -112,23 +287,29 @@ func InitMongo(ctx context.Context) {
 		laptop := models.Product{
 			ID:          primitive.NewObjectID(),
 			Name:        "Laptop",
+			Slug:        "laptop",
+			SKU:         "LAPTOP-001",
 			Description: "High-performance laptop",
 			Price:       999.99,
 			StockLevel:  50,
 			CategoryID:  electronicsCategory.ID,
 			CreatedAt:   now,
 			UpdatedAt:   now,
+			Version:     1,
 		}
 
 		tshirt := models.Product{
 			ID:          primitive.NewObjectID(),
 			Name:        "T-shirt",
+			Slug:        "t-shirt",
+			SKU:         "TSHIRT-001",
 			Description: "Cotton t-shirt",
 			Price:       19.99,
 			StockLevel:  100,
 			CategoryID:  clothingCategory.ID,
 			CreatedAt:   now,
 			UpdatedAt:   now,
+			Version:     1,
 		}
 
 		_, err = productsCollection.InsertOne(ctx, laptop)
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"inventory/models"
+	"inventory/pagination"
+	"inventory/repository"
+	"net/http"
+	"time"
+)
+
+var priceHistorySort = pagination.Sort{{Field: "changed_at", Desc: true}}
+
+// GetPriceHistory lists the price changes of a product, newest first.
+func GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	// Convert string ID to ObjectID
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	// Check if product exists
+	count, err := productsCollection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count == 0 {
+		repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	query, err := pagination.ParseQuery(r.URL.Query(), priceHistorySort)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var changes []models.PriceChange
+	page, err := pagination.Fetch(ctx, priceHistoryCollection, bson.M{"product_id": id}, query, &changes)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, pagination.NewResponse(r, changes, page))
+}
+
+// recordPriceChange adds an entry to the price history.
+func recordPriceChange(ctx context.Context, productID primitive.ObjectID, oldPrice, newPrice float64, reason string, scheduleID *primitive.ObjectID) error {
+	_, err := priceHistoryCollection.InsertOne(ctx, models.PriceChange{
+		ProductID:  productID,
+		OldPrice:   oldPrice,
+		NewPrice:   newPrice,
+		Reason:     reason,
+		ScheduleID: scheduleID,
+		ChangedAt:  time.Now(),
+	})
+	return err
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"inventory/gtin"
+	"inventory/models"
+	"inventory/repository"
+	"inventory/slug"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// productDocument holds the fields of a product that PATCH and PUT edit.
+// Options, variants and images have endpoints of their own; components only
+// apply to bundles.
+type productDocument struct {
+	Name        string                   `json:"name"`
+	Slug        string                   `json:"slug,omitempty"`
+	SKU         string                   `json:"sku,omitempty"`
+	Barcode     string                   `json:"barcode,omitempty"`
+	Description string                   `json:"description"`
+	Price       float64                  `json:"price"`
+	StockLevel  *int                     `json:"stock_level,omitempty"`
+	Weight      float64                  `json:"weight"`
+	Dimensions  models.Dimensions        `json:"dimensions"`
+	CategoryID  primitive.ObjectID       `json:"category_id"`
+	Attributes  map[string]interface{}   `json:"attributes,omitempty"`
+	Components  []models.BundleComponent `json:"components,omitempty"`
+}
+
+// fieldError describes one invalid field of a request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrors reports invalid fields as an error, for checks that need
+// other documents and so run after decoding.
+type fieldErrors []fieldError
+
+func (e fieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// respondWithFieldErrors answers 422 listing every invalid field.
+func respondWithFieldErrors(w http.ResponseWriter, errs []fieldError) {
+	repository.RespondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":  "Invalid product",
+		"fields": errs,
+	})
+}
+
+// newProductDocument returns the editable fields of a product as a decoded
+// JSON document that patches can be applied to.
+func newProductDocument(product models.Product) map[string]interface{} {
+	// Bundle stock is computed, so it cannot be edited
+	stockLevel := &product.StockLevel
+	if product.Type == models.ProductTypeBundle {
+		stockLevel = nil
+	}
+	data, _ := json.Marshal(productDocument{
+		Name:        product.Name,
+		Slug:        product.Slug,
+		SKU:         product.SKU,
+		Barcode:     product.Barcode,
+		Description: product.Description,
+		Price:       product.Price,
+		StockLevel:  stockLevel,
+		Weight:      product.Weight,
+		Dimensions:  product.Dimensions,
+		CategoryID:  product.CategoryID,
+		Attributes:  product.Attributes,
+		Components:  product.Components,
+	})
+
+	var doc map[string]interface{}
+	json.Unmarshal(data, &doc)
+	return doc
+}
+
+// decodeProductDocument checks a patched or replacement document strictly:
+// unknown fields, wrong types and invalid values are all reported instead
+// of being ignored. Name, price and category_id are required; other missing
+// fields are cleared. Stock of a product with variants is the sum of its
+// variants and can be left out. Bundles require components and have no
+// stock of their own.
+func decodeProductDocument(value interface{}, existing models.Product) (productDocument, []fieldError) {
+	var doc productDocument
+	errs := []fieldError{}
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, fieldError{field, fmt.Sprintf(format, args...)})
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		fail("", "Product must be a JSON object")
+		return doc, errs
+	}
+
+	// Visit fields in a stable order so errors are reported consistently
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	required := []string{"name", "price", "category_id"}
+	if existing.Type == models.ProductTypeBundle {
+		required = append(required, "components")
+	}
+	for _, name := range required {
+		if _, ok := fields[name]; !ok {
+			fail(name, "is required")
+		}
+	}
+
+	for _, name := range names {
+		raw := fields[name]
+		switch name {
+		case "name", "slug", "sku", "barcode", "description":
+			s, ok := raw.(string)
+			if !ok {
+				fail(name, "must be a string")
+				continue
+			}
+			switch name {
+			case "name":
+				if s == "" {
+					fail(name, "must not be empty")
+				}
+				doc.Name = s
+			case "slug":
+				if s != "" && !slug.Valid(s) {
+					fail(name, errInvalidSlug.Error())
+				}
+				doc.Slug = s
+			case "sku":
+				if s != "" && !skuPattern.MatchString(s) {
+					fail(name, "must be 1-64 letters, digits, dots, underscores or hyphens")
+				}
+				doc.SKU = s
+			case "barcode":
+				if s != "" && !gtin.Valid(s) {
+					fail(name, "must be a GTIN-8, 12, 13 or 14 with a valid check digit")
+				}
+				doc.Barcode = s
+			case "description":
+				doc.Description = s
+			}
+
+		case "price":
+			price, ok := raw.(float64)
+			if !ok || price <= 0 {
+				fail(name, "must be a number greater than 0")
+				continue
+			}
+			doc.Price = price
+
+		case "weight":
+			weight, ok := raw.(float64)
+			if !ok || weight < 0 {
+				fail(name, "must be a number of at least 0")
+				continue
+			}
+			doc.Weight = weight
+
+		case "stock_level":
+			stockLevel, ok := raw.(float64)
+			if !ok || stockLevel < 0 || stockLevel != math.Trunc(stockLevel) {
+				fail(name, "must be an integer of at least 0")
+				continue
+			}
+			if existing.Type == models.ProductTypeBundle {
+				fail(name, "stock of a bundle is computed from its components")
+				continue
+			}
+			if len(existing.Variants) > 0 && int(stockLevel) != existing.StockLevel {
+				fail(name, "stock of a product with variants is set per variant")
+				continue
+			}
+			n := int(stockLevel)
+			doc.StockLevel = &n
+
+		case "dimensions":
+			dimensions, ok := raw.(map[string]interface{})
+			if !ok {
+				fail(name, "must be an object")
+				continue
+			}
+			keys := make([]string, 0, len(dimensions))
+			for key := range dimensions {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				size, ok := dimensions[key].(float64)
+				if !ok || size < 0 {
+					fail(name+"."+key, "must be a number of at least 0")
+					continue
+				}
+				switch key {
+				case "length":
+					doc.Dimensions.Length = size
+				case "width":
+					doc.Dimensions.Width = size
+				case "height":
+					doc.Dimensions.Height = size
+				default:
+					fail(name+"."+key, "unknown field")
+				}
+			}
+
+		case "category_id":
+			idStr, ok := raw.(string)
+			id, err := primitive.ObjectIDFromHex(idStr)
+			if !ok || err != nil {
+				fail(name, "must be a category ID")
+				continue
+			}
+			doc.CategoryID = id
+
+		case "attributes":
+			attributes, ok := raw.(map[string]interface{})
+			if !ok {
+				fail(name, "must be an object")
+				continue
+			}
+			if len(attributes) > 0 {
+				doc.Attributes = attributes
+			}
+
+		case "components":
+			if existing.Type != models.ProductTypeBundle {
+				fail(name, "only bundles have components")
+				continue
+			}
+			items, ok := raw.([]interface{})
+			if !ok || len(items) == 0 {
+				fail(name, "must be an array of at least one component")
+				continue
+			}
+			for i, item := range items {
+				field := fmt.Sprintf("%s.%d", name, i)
+				if component, ok := decodeBundleComponent(item, field, fail); ok {
+					doc.Components = append(doc.Components, component)
+				}
+			}
+
+		default:
+			fail(name, "unknown field")
+		}
+	}
+
+	// Stock of variant products is derived from the variants
+	if doc.StockLevel == nil && len(existing.Variants) > 0 {
+		stockLevel := existing.StockLevel
+		doc.StockLevel = &stockLevel
+	}
+
+	return doc, errs
+}
+
+// decodeBundleComponent checks one entry of a bundle's components, reporting
+// problems through fail.
+func decodeBundleComponent(value interface{}, field string, fail func(field, format string, args ...interface{})) (models.BundleComponent, bool) {
+	var component models.BundleComponent
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		fail(field, "must be an object")
+		return component, false
+	}
+
+	valid := true
+	for _, name := range []string{"product_id", "quantity"} {
+		if _, ok := fields[name]; !ok {
+			fail(field+"."+name, "is required")
+			valid = false
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		raw := fields[key]
+		switch key {
+		case "product_id", "variant_id":
+			if key == "variant_id" && raw == nil {
+				continue
+			}
+			idStr, ok := raw.(string)
+			id, err := primitive.ObjectIDFromHex(idStr)
+			if !ok || err != nil {
+				fail(field+"."+key, "must be an ID")
+				valid = false
+				continue
+			}
+			if key == "product_id" {
+				component.ProductID = id
+			} else {
+				component.VariantID = &id
+			}
+
+		case "quantity":
+			quantity, ok := raw.(float64)
+			if !ok || quantity < 1 || quantity != math.Trunc(quantity) {
+				fail(field+"."+key, "must be an integer of at least 1")
+				valid = false
+				continue
+			}
+			component.Quantity = int(quantity)
+
+		default:
+			fail(field+"."+key, "unknown field")
+			valid = false
+		}
+	}
+	return component, valid
+}
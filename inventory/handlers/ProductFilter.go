@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/models"
+	"inventory/pagination"
+	"inventory/repository"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+var productSortFields = []string{"name", "price", "stock_level", "created_at", "updated_at"}
+
+var defaultProductSort = pagination.Sort{{Field: "created_at", Desc: true}}
+
+// filterError reports an invalid filter parameter in a list request.
+type filterError struct {
+	error
+}
+
+// respondWithFilterError answers 400 for invalid parameters and 500 for
+// anything else that went wrong while building a filter.
+func respondWithFilterError(w http.ResponseWriter, err error) {
+	var fe filterError
+	if errors.As(err, &fe) {
+		repository.RespondWithError(w, http.StatusBadRequest, fe.Error())
+		return
+	}
+	repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+// productFilter builds the product list filter from the query parameters:
+//
+//	category     category names or slugs, comma-separated or repeated
+//	category_id  category IDs, comma-separated or repeated
+//	include_descendants  also match products in subcategories
+//	name         case-insensitive name prefix
+//	min_price, max_price, min_stock, max_stock
+//	in_stock     only products with stock left
+//	created_from, created_to, updated_from, updated_to
+//	attr.<name>, attr.<name>.min, attr.<name>.max  attribute values
+//	include_deleted  also list deleted products
+//
+// The stock filters are only matched correctly for bundles, whose stock is
+// computed, by the stages of productPipeline.
+func productFilter(ctx context.Context, values url.Values) (bson.M, error) {
+	filter := bson.M{}
+
+	withDeleted, err := includeDeleted(values)
+	if err != nil {
+		return nil, err
+	}
+	if !withDeleted {
+		notDeleted(filter)
+	}
+
+	categoryIDs, err := categoryFilterIDs(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+	if categoryIDs != nil {
+		filter["category_id"] = bson.M{"$in": categoryIDs}
+	}
+
+	if name := values.Get("name"); name != "" {
+		filter["name"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name), Options: "i"}
+	}
+
+	minPrice, err := repository.ParseFloatParam(values, "min_price")
+	if err != nil {
+		return nil, filterError{err}
+	}
+	maxPrice, err := repository.ParseFloatParam(values, "max_price")
+	if err != nil {
+		return nil, filterError{err}
+	}
+	if priceRange := repository.RangeFilter(minPrice, maxPrice); priceRange != nil {
+		filter["price"] = priceRange
+	}
+
+	minStock, err := repository.ParseIntParam(values, "min_stock")
+	if err != nil {
+		return nil, filterError{err}
+	}
+	maxStock, err := repository.ParseIntParam(values, "max_stock")
+	if err != nil {
+		return nil, filterError{err}
+	}
+	stockRange := repository.RangeFilter(minStock, maxStock)
+	if inStockStr := values.Get("in_stock"); inStockStr != "" {
+		inStock, err := strconv.ParseBool(inStockStr)
+		if err != nil {
+			return nil, filterError{fmt.Errorf("invalid in_stock: %s", inStockStr)}
+		}
+		if inStock {
+			if stockRange == nil {
+				stockRange = bson.M{}
+			}
+			stockRange["$gt"] = 0
+		}
+	}
+	if stockRange != nil {
+		filter["stock_level"] = stockRange
+	}
+
+	for _, field := range []string{"created", "updated"} {
+		from, err := repository.ParseTimeParam(values, field+"_from", false)
+		if err != nil {
+			return nil, filterError{err}
+		}
+		to, err := repository.ParseTimeParam(values, field+"_to", true)
+		if err != nil {
+			return nil, filterError{err}
+		}
+		if dateRange := repository.RangeFilter(from, to); dateRange != nil {
+			filter[field+"_at"] = dateRange
+		}
+	}
+
+	attributes, err := attributeFilter(values)
+	if err != nil {
+		return nil, err
+	}
+	for field, condition := range attributes {
+		filter[field] = condition
+	}
+
+	return filter, nil
+}
+
+// productPipeline returns the aggregation stages that select the products a
+// productFilter filter matches. Conditions on the stock level are matched
+// after bundleStockStages has worked out the stock of bundles.
+func productPipeline(filter bson.M) mongo.Pipeline {
+	match := bson.M{}
+	for field, condition := range filter {
+		if field != "stock_level" {
+			match[field] = condition
+		}
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+	pipeline = append(pipeline, bundleStockStages()...)
+	if stockRange, ok := filter["stock_level"]; ok {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"stock_level": stockRange}}})
+	}
+	return pipeline
+}
+
+// categoryFilterIDs resolves the category and category_id parameters to a
+// list of IDs, or nil if neither is given. Unknown category names match no
+// products.
+func categoryFilterIDs(ctx context.Context, values url.Values) ([]primitive.ObjectID, error) {
+	includeDescendants := false
+	if includeStr := values.Get("include_descendants"); includeStr != "" {
+		var err error
+		includeDescendants, err = strconv.ParseBool(includeStr)
+		if err != nil {
+			return nil, filterError{fmt.Errorf("invalid include_descendants: %s", includeStr)}
+		}
+	}
+
+	names := repository.ParseListParam(values, "category")
+	idStrs := repository.ParseListParam(values, "category_id")
+	if len(names) == 0 && len(idStrs) == 0 {
+		return nil, nil
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, idStr := range idStrs {
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			return nil, filterError{fmt.Errorf("invalid category ID: %s", idStr)}
+		}
+		ids = append(ids, id)
+	}
+
+	if len(names) > 0 {
+		patterns := make([]interface{}, len(names))
+		for i, name := range names {
+			patterns[i] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name) + "$", Options: "i"}
+		}
+
+		cursor, err := categoriesCollection.Find(ctx, bson.M{"$or": []bson.M{
+			{"name": bson.M{"$in": patterns}},
+			{"slug": bson.M{"$in": names}},
+		}})
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var categories []models.Category
+		if err := cursor.All(ctx, &categories); err != nil {
+			return nil, err
+		}
+		for _, category := range categories {
+			ids = append(ids, category.ID)
+		}
+	}
+
+	if includeDescendants && len(ids) > 0 {
+		descendants, err := categoriesCollection.Distinct(ctx, "_id", bson.M{"ancestors": bson.M{"$in": ids}})
+		if err != nil {
+			return nil, err
+		}
+		for _, descendant := range descendants {
+			if id, ok := descendant.(primitive.ObjectID); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/models"
+	"inventory/repository"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMaxImageSize = 5 << 20
+
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// maxImageSize is the largest accepted upload in bytes, from MAX_IMAGE_SIZE.
+var maxImageSize = func() int64 {
+	size, err := strconv.ParseInt(getEnvOrDefault("MAX_IMAGE_SIZE", strconv.Itoa(defaultMaxImageSize)), 10, 64)
+	if err != nil || size <= 0 {
+		log.Printf("Invalid MAX_IMAGE_SIZE, using %d bytes", defaultMaxImageSize)
+		return defaultMaxImageSize
+	}
+	return size
+}()
+
+var errImageTooLarge = errors.New("Image is too large")
+
+func productImageURL(productID, imageID primitive.ObjectID) string {
+	return fmt.Sprintf("/products/%s/images/%s", productID.Hex(), imageID.Hex())
+}
+
+// UploadProductImage stores an image sent as the "file" field of a multipart
+// form in GridFS and appends it to the product's images. The first image
+// becomes the primary one.
+func UploadProductImage(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Image must be sent as the multipart field \"file\"")
+		return
+	}
+	defer file.Close()
+
+	// Sniff the content type from the data rather than trusting the client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !allowedImageTypes[contentType] {
+		repository.RespondWithError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported image type %s", contentType))
+		return
+	}
+
+	image := models.ProductImage{
+		ID:          primitive.NewObjectID(),
+		Filename:    header.Filename,
+		ContentType: contentType,
+		Primary:     len(product.Images) == 0,
+		UploadedAt:  time.Now(),
+	}
+	image.URL = productImageURL(product.ID, image.ID)
+
+	source := &limitedReader{r: io.MultiReader(bytes.NewReader(head), file), limit: maxImageSize}
+	err = imagesBucket.UploadFromStreamWithID(
+		image.ID,
+		image.Filename,
+		source,
+		options.GridFSUpload().SetMetadata(bson.M{"product_id": product.ID, "content_type": contentType}),
+	)
+	if err != nil {
+		if errors.Is(err, errImageTooLarge) {
+			repository.RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Image must not exceed %d bytes", maxImageSize))
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	image.Size = source.read
+
+	_, err = productsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": product.ID},
+		bson.M{"$push": bson.M{"images": image}, "$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+	)
+	if err != nil {
+		if deleteErr := imagesBucket.DeleteContext(ctx, image.ID); deleteErr != nil {
+			log.Printf("Failed to delete orphaned image %s: %v", image.ID.Hex(), deleteErr)
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Thumbnails are added to the image once they are ready
+	queueThumbnails(product.ID, image)
+
+	repository.RespondWithJSON(w, http.StatusCreated, image)
+}
+
+func GetProductImages(w http.ResponseWriter, r *http.Request) {
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+
+	images := product.Images
+	if images == nil {
+		images = []models.ProductImage{}
+	}
+	repository.RespondWithJSON(w, http.StatusOK, images)
+}
+
+// DownloadProductImage streams an image from GridFS. The size query parameter
+// selects a thumbnail, the original is served until it has been generated.
+func DownloadProductImage(w http.ResponseWriter, r *http.Request) {
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	image, ok := findImage(w, r, product)
+	if !ok {
+		return
+	}
+
+	fileID := image.ID
+	cacheControl := "public, max-age=86400"
+	if size := r.URL.Query().Get("size"); size != "" && size != "original" {
+		if _, ok := thumbnailSizes[size]; !ok {
+			repository.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid size, must be one of: original, %s", strings.Join(thumbnailSizeNames(), ", ")))
+			return
+		}
+		if thumbnailID, ok := image.Thumbnails[size]; ok {
+			fileID = thumbnailID
+		} else {
+			cacheControl = "no-cache"
+		}
+	}
+
+	stream, err := imagesBucket.OpenDownloadStream(fileID)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			repository.RespondWithError(w, http.StatusNotFound, "Image not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(stream.GetFile().Length, 10))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, stream); err != nil {
+		log.Printf("Failed to stream image %s: %v", image.ID.Hex(), err)
+	}
+}
+
+// UpdateProductImage moves an image to a new position in the list or makes
+// it the primary image.
+func UpdateProductImage(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	image, ok := findImage(w, r, product)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Position *int  `json:"position"`
+		Primary  *bool `json:"primary"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Position == nil && (req.Primary == nil || !*req.Primary) {
+		repository.RespondWithError(w, http.StatusBadRequest, "No valid fields to update")
+		return
+	}
+
+	images := product.Images
+	if req.Position != nil {
+		if *req.Position < 0 || *req.Position >= len(images) {
+			repository.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Position must be between 0 and %d", len(images)-1))
+			return
+		}
+		images = moveImage(images, image.ID, *req.Position)
+	}
+	if req.Primary != nil && *req.Primary {
+		for i := range images {
+			images[i].Primary = images[i].ID == image.ID
+		}
+	}
+
+	if !saveImages(w, ctx, product, images) {
+		return
+	}
+	repository.RespondWithJSON(w, http.StatusOK, images)
+}
+
+// DeleteProductImage removes an image from the product and GridFS. If it was
+// the primary image, the next one takes its place.
+func DeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	image, ok := findImage(w, r, product)
+	if !ok {
+		return
+	}
+
+	images := []models.ProductImage{}
+	for _, other := range product.Images {
+		if other.ID != image.ID {
+			images = append(images, other)
+		}
+	}
+	if image.Primary && len(images) > 0 {
+		images[0].Primary = true
+	}
+
+	if !saveImages(w, ctx, product, images) {
+		return
+	}
+
+	if err := deleteImageFiles(ctx, image); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteImageFiles removes an image and its thumbnails from GridFS.
+func deleteImageFiles(ctx context.Context, image models.ProductImage) error {
+	ids := []primitive.ObjectID{image.ID}
+	for _, id := range image.Thumbnails {
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids {
+		err := imagesBucket.DeleteContext(ctx, id)
+		if err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveImages replaces the product's image list, failing if the product
+// changed since it was read.
+func saveImages(w http.ResponseWriter, ctx context.Context, product models.Product, images []models.ProductImage) bool {
+	result, err := productsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": product.ID, "version": product.Version},
+		bson.M{"$set": bson.M{"images": images, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+	)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if result.MatchedCount == 0 {
+		repository.RespondWithError(w, http.StatusConflict, errProductChanged.Error())
+		return false
+	}
+	return true
+}
+
+func moveImage(images []models.ProductImage, id primitive.ObjectID, position int) []models.ProductImage {
+	var moved models.ProductImage
+	rest := make([]models.ProductImage, 0, len(images))
+	for _, image := range images {
+		if image.ID == id {
+			moved = image
+			continue
+		}
+		rest = append(rest, image)
+	}
+
+	result := make([]models.ProductImage, 0, len(images))
+	result = append(result, rest[:position]...)
+	result = append(result, moved)
+	return append(result, rest[position:]...)
+}
+
+// findRequestProduct loads the product named in the URL, writing an error
+// response and returning false if it cannot be found.
+func findRequestProduct(w http.ResponseWriter, r *http.Request) (models.Product, bool) {
+	var product models.Product
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return product, false
+	}
+
+	err = productsCollection.FindOne(context.Background(), notDeleted(bson.M{"_id": id})).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+			return product, false
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return product, false
+	}
+	return product, true
+}
+
+func findImage(w http.ResponseWriter, r *http.Request, product models.Product) (models.ProductImage, bool) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["image_id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid image ID")
+		return models.ProductImage{}, false
+	}
+	for _, image := range product.Images {
+		if image.ID == id {
+			return image, true
+		}
+	}
+	repository.RespondWithError(w, http.StatusNotFound, "Image not found")
+	return models.ProductImage{}, false
+}
+
+// limitedReader fails with errImageTooLarge once more than limit bytes have
+// been read.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n, errImageTooLarge
+	}
+	return n, err
+}
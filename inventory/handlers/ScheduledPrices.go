@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/models"
+	"inventory/repository"
+	"log"
+	"net/http"
+	"time"
+)
+
+var errScheduleChanged = errors.New("scheduled price or product changed concurrently")
+
+// CreateScheduledPrice schedules a new price for a product. Schedules of the
+// same product may not overlap.
+func CreateScheduledPrice(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateScheduledPriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate request
+	now := time.Now()
+	if req.Price <= 0 {
+		repository.RespondWithError(w, http.StatusBadRequest, "Price must be greater than 0")
+		return
+	}
+	if req.StartsAt.IsZero() {
+		repository.RespondWithError(w, http.StatusBadRequest, "starts_at is required")
+		return
+	}
+	if req.EndsAt != nil && (!req.EndsAt.After(req.StartsAt) || !req.EndsAt.After(now)) {
+		repository.RespondWithError(w, http.StatusBadRequest, "ends_at must be after starts_at and in the future")
+		return
+	}
+
+	// Open-ended schedules only occupy their start time
+	start, end := req.StartsAt, req.StartsAt
+	if req.EndsAt != nil {
+		end = *req.EndsAt
+	}
+	count, err := scheduledPricesCollection.CountDocuments(ctx, bson.M{
+		"product_id": product.ID,
+		"status":     bson.M{"$in": bson.A{"scheduled", "active"}},
+		"starts_at":  bson.M{"$lte": end},
+		"$or": bson.A{
+			bson.M{"ends_at": bson.M{"$gte": start}},
+			bson.M{"ends_at": nil, "starts_at": bson.M{"$gte": start}},
+		},
+	})
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		repository.RespondWithError(w, http.StatusConflict, "Scheduled price overlaps an existing one")
+		return
+	}
+
+	schedule := models.ScheduledPrice{
+		ID:        primitive.NewObjectID(),
+		ProductID: product.ID,
+		Price:     req.Price,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		Status:    "scheduled",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := scheduledPricesCollection.InsertOne(ctx, schedule); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusCreated, schedule)
+}
+
+func GetScheduledPrices(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"product_id": product.ID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := scheduledPricesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "starts_at", Value: 1}}))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	schedules := []models.ScheduledPrice{}
+	if err := cursor.All(ctx, &schedules); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, schedules)
+}
+
+// CancelScheduledPrice cancels a schedule that has not started yet.
+func CancelScheduledPrice(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+
+	productID, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+	scheduleID, err := primitive.ObjectIDFromHex(vars["schedule_id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid scheduled price ID")
+		return
+	}
+
+	var schedule models.ScheduledPrice
+	err = scheduledPricesCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": scheduleID, "product_id": productID, "status": "scheduled"},
+		bson.M{"$set": bson.M{"status": "cancelled", "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&schedule)
+	if err == mongo.ErrNoDocuments {
+		// Tell a missing schedule apart from one that already started
+		count, err := scheduledPricesCollection.CountDocuments(ctx, bson.M{"_id": scheduleID, "product_id": productID})
+		if err != nil {
+			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if count == 0 {
+			repository.RespondWithError(w, http.StatusNotFound, "Scheduled price not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusConflict, "Only scheduled prices that have not started can be cancelled")
+		return
+	}
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, schedule)
+}
+
+// ApplyScheduledPrices starts every scheduled price due at now and ends every
+// sale that is over, returning how many schedules changed state. Schedules
+// that fail are logged and retried on the next run.
+func ApplyScheduledPrices(ctx context.Context, now time.Time) (int, error) {
+	applied := 0
+
+	due, err := findSchedules(ctx, bson.M{"status": "scheduled", "starts_at": bson.M{"$lte": now}}, "starts_at")
+	if err != nil {
+		return applied, err
+	}
+	for _, schedule := range due {
+		if err := startScheduledPrice(ctx, schedule, now); err != nil {
+			log.Printf("Failed to start scheduled price %s: %v", schedule.ID.Hex(), err)
+			continue
+		}
+		applied++
+	}
+
+	// Sales that started late in this run may already be over
+	over, err := findSchedules(ctx, bson.M{"status": "active", "ends_at": bson.M{"$lte": now}}, "ends_at")
+	if err != nil {
+		return applied, err
+	}
+	for _, schedule := range over {
+		if err := endScheduledPrice(ctx, schedule, now); err != nil {
+			log.Printf("Failed to end scheduled price %s: %v", schedule.ID.Hex(), err)
+			continue
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+func findSchedules(ctx context.Context, filter bson.M, sortField string) ([]models.ScheduledPrice, error) {
+	cursor, err := scheduledPricesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: sortField, Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var schedules []models.ScheduledPrice
+	err = cursor.All(ctx, &schedules)
+	return schedules, err
+}
+
+// startScheduledPrice sets the product's price to the scheduled one and
+// remembers the price it replaced.
+func startScheduledPrice(ctx context.Context, schedule models.ScheduledPrice, now time.Time) error {
+	// Start a session for transaction
+	session, err := Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		set := bson.M{"status": "applied", "updated_at": now}
+		if schedule.EndsAt != nil {
+			set["status"] = "active"
+		}
+
+		var product models.Product
+		err := productsCollection.FindOne(sessionContext, notDeleted(bson.M{"_id": schedule.ProductID})).Decode(&product)
+		if err == mongo.ErrNoDocuments {
+			// The product is gone, so there is nothing to apply
+			set["status"] = "cancelled"
+		} else if err != nil {
+			return err
+		} else {
+			result, err := productsCollection.UpdateOne(
+				sessionContext,
+				bson.M{"_id": product.ID, "price": product.Price},
+				bson.M{"$set": bson.M{"price": schedule.Price, "updated_at": now}, "$inc": bson.M{"version": 1}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return errScheduleChanged
+			}
+
+			err = recordPriceChange(sessionContext, product.ID, product.Price, schedule.Price, "scheduled", &schedule.ID)
+			if err != nil {
+				return err
+			}
+			set["previous_price"] = product.Price
+		}
+
+		result, err := scheduledPricesCollection.UpdateOne(
+			sessionContext,
+			bson.M{"_id": schedule.ID, "status": "scheduled"},
+			bson.M{"$set": set},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errScheduleChanged
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		session.AbortTransaction(ctx)
+	}
+	return err
+}
+
+// endScheduledPrice restores the price a sale replaced. If the price was
+// changed by hand during the sale, that price is kept.
+func endScheduledPrice(ctx context.Context, schedule models.ScheduledPrice, now time.Time) error {
+	// Start a session for transaction
+	session, err := Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		result, err := productsCollection.UpdateOne(
+			sessionContext,
+			bson.M{"_id": schedule.ProductID, "price": schedule.Price},
+			bson.M{"$set": bson.M{"price": schedule.PreviousPrice, "updated_at": now}, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			err := recordPriceChange(sessionContext, schedule.ProductID, schedule.Price, schedule.PreviousPrice, "schedule_ended", &schedule.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err = scheduledPricesCollection.UpdateOne(
+			sessionContext,
+			bson.M{"_id": schedule.ID, "status": "active"},
+			bson.M{"$set": bson.M{"status": "ended", "updated_at": now}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errScheduleChanged
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		session.AbortTransaction(ctx)
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"inventory/models"
+	"inventory/repository"
+	"inventory/search"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// autocompleteCandidates caps how many names are scored for typos
+	autocompleteCandidates = 500
+)
+
+// SearchProducts runs a full-text search over product names and
+// descriptions, ranked by relevance. With autocomplete=true it instead
+// returns product names whose words start with q, tolerating typos.
+func SearchProducts(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	values := r.URL.Query()
+
+	q := values.Get("q")
+	if q == "" {
+		repository.RespondWithError(w, http.StatusBadRequest, "Search query q is required")
+		return
+	}
+
+	limit := defaultSearchLimit
+	parsedLimit, err := repository.ParseIntParam(values, "limit")
+	if err != nil || (parsedLimit != nil && *parsedLimit <= 0) {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	if parsedLimit != nil {
+		limit = min(*parsedLimit, maxSearchLimit)
+	}
+
+	// The same filters as the product list narrow the search
+	filter, err := productFilter(ctx, values)
+	if err != nil {
+		respondWithFilterError(w, err)
+		return
+	}
+
+	if values.Get("autocomplete") == "true" {
+		autocompleteProducts(w, ctx, filter, q, limit)
+		return
+	}
+
+	// Bundle stock is computed from the components
+	filter["$text"] = bson.M{"$search": q}
+	pipeline := append(productPipeline(filter),
+		bson.D{{Key: "$set", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: int64(limit)}},
+	)
+
+	cursor, err := productsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.ProductSearchResult{}
+	if err := cursor.All(ctx, &results); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Mark the matched terms
+	terms := search.Terms(q)
+	for i := range results {
+		highlights := map[string]string{}
+		if name := search.Highlight(results[i].Name, terms); name != "" {
+			highlights["name"] = name
+		}
+		if description := search.Highlight(results[i].Description, terms); description != "" {
+			highlights["description"] = description
+		}
+		results[i].Highlights = highlights
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, results)
+}
+
+// autocompleteProducts suggests product names with a word starting with q.
+// Candidates may start with a typo too and are ranked by edit distance, so
+// "lpat" and "kaptop" still suggest "Laptop".
+func autocompleteProducts(w http.ResponseWriter, ctx context.Context, filter bson.M, q string, limit int) {
+	// Kept apart from a name filter, which must match as well
+	filter["$and"] = []bson.M{{"name": primitive.Regex{Pattern: search.CandidatePattern(q), Options: "i"}}}
+	pipeline := append(productPipeline(filter),
+		bson.D{{Key: "$project", Value: bson.M{"name": 1}}},
+		bson.D{{Key: "$limit", Value: autocompleteCandidates}},
+	)
+
+	cursor, err := productsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var candidates []models.ProductSuggestion
+	if err := cursor.All(ctx, &candidates); err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	maxDistance := search.MaxPrefixDistance(utf8.RuneCountInString(q))
+	suggestions := []models.ProductSuggestion{}
+	for _, candidate := range candidates {
+		candidate.Distance = search.PrefixDistance(q, candidate.Name)
+		if candidate.Distance <= maxDistance {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Distance != suggestions[j].Distance {
+			return suggestions[i].Distance < suggestions[j].Distance
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, suggestions)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/repository"
+	"inventory/slug"
+	"net/http"
+)
+
+var (
+	errInvalidSlug = errors.New("Slug may only contain lower-case letters, digits and single hyphens")
+	errSlugTaken   = errors.New("Slug already in use")
+)
+
+// resolveSlug returns the slug to store for the document with the given ID:
+// the requested slug if there is one, otherwise one generated from name and
+// made unique with a numeric suffix. Slugs a document used to have stay
+// reserved so that their redirects keep working, as do the reserved ones,
+// which documents not yet written will take.
+func resolveSlug(ctx context.Context, coll *mongo.Collection, requested, name string, id primitive.ObjectID, reserved map[string]bool) (string, error) {
+	if requested != "" {
+		if !slug.Valid(requested) {
+			return "", errInvalidSlug
+		}
+		taken, err := slugTaken(ctx, coll, requested, id, reserved)
+		if err != nil {
+			return "", err
+		}
+		if taken {
+			return "", errSlugTaken
+		}
+		return requested, nil
+	}
+
+	base := slug.Make(name)
+	if base == "" {
+		base = id.Hex()
+	}
+	candidate := base
+	for i := 2; ; i++ {
+		taken, err := slugTaken(ctx, coll, candidate, id, reserved)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func slugTaken(ctx context.Context, coll *mongo.Collection, s string, id primitive.ObjectID, reserved map[string]bool) (bool, error) {
+	if reserved[s] {
+		return true, nil
+	}
+	count, err := coll.CountDocuments(ctx, bson.M{
+		"_id": bson.M{"$ne": id},
+		"$or": []bson.M{{"slug": s}, {"old_slugs": s}},
+	})
+	return count > 0, err
+}
+
+// renameSlug returns the old slugs to store after a document moves from
+// current to next, keeping current for redirects.
+func renameSlug(oldSlugs []string, current, next string) []string {
+	kept := []string{}
+	for _, s := range oldSlugs {
+		if s != next && s != current {
+			kept = append(kept, s)
+		}
+	}
+	if current != "" && current != next {
+		kept = append(kept, current)
+	}
+	return kept
+}
+
+func respondWithSlugError(w http.ResponseWriter, err error) {
+	switch err {
+	case errInvalidSlug:
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errSlugTaken:
+		repository.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// findBySlug decodes the document with the given slug into result. If only
+// an old slug matches it still decodes the document and reports moved, so
+// the caller can redirect to the current slug.
+func findBySlug(ctx context.Context, coll *mongo.Collection, s string, result interface{}) (moved bool, err error) {
+	err = coll.FindOne(ctx, bson.M{"slug": s}).Decode(result)
+	if err != mongo.ErrNoDocuments {
+		return false, err
+	}
+	err = coll.FindOne(ctx, bson.M{"old_slugs": s}).Decode(result)
+	return err == nil, err
+}
+
+// backfillSlugs gives every document in coll without a slug one generated
+// from its name.
+func backfillSlugs(ctx context.Context, coll *mongo.Collection) error {
+	cursor, err := coll.Find(ctx, bson.M{"slug": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Name string             `bson:"name"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		s, err := resolveSlug(ctx, coll, "", doc.Name, doc.ID, nil)
+		if err != nil {
+			return err
+		}
+		_, err = coll.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"slug": s}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/models"
+	"inventory/repository"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// notDeleted restricts a product filter to products that are not deleted.
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// includeDeleted reads the include_deleted query parameter, which lets
+// administrators see deleted products.
+func includeDeleted(values url.Values) (bool, error) {
+	value := values.Get("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, filterError{fmt.Errorf("invalid include_deleted: %s", value)}
+	}
+	return include, nil
+}
+
+// RestoreProduct undoes the soft deletion of a product.
+func RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	// Convert string ID to ObjectID
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	var product models.Product
+	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if product.DeletedAt == nil {
+		repository.RespondWithError(w, http.StatusConflict, "Product is not deleted")
+		return
+	}
+
+	// The category may have been deleted after the product
+	count, err := categoriesCollection.CountDocuments(ctx, bson.M{"_id": product.CategoryID})
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count == 0 {
+		repository.RespondWithError(w, http.StatusConflict, "Cannot restore product whose category no longer exists")
+		return
+	}
+
+	_, err = productsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$unset": bson.M{"deleted_at": "", "kept_for_orders": ""}, "$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+	)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Get restored product
+	var restoredProduct models.Product
+	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&restoredProduct)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithProduct(w, http.StatusOK, restoredProduct)
+}
+
+// PurgeDeletedProducts permanently removes products deleted before the
+// cutoff together with their images, price history and scheduled prices.
+// Products that orders refer to are kept so the orders stay readable. It
+// returns how many products were purged.
+func PurgeDeletedProducts(ctx context.Context, cutoff time.Time) (int, error) {
+	return purgeProducts(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+}
+
+// purgeProducts permanently removes the products matching filter that no
+// order refers to. The filter must only match deleted products. Products
+// found to be referenced are marked as kept so later purges skip them
+// instead of searching the orders again.
+func purgeProducts(ctx context.Context, filter bson.M) (int, error) {
+	filter["kept_for_orders"] = bson.M{"$exists": false}
+	cursor, err := productsCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, product := range products {
+		// Only touch the product if it was not restored meanwhile
+		productFilter := bson.M{"_id": product.ID}
+		for key, value := range filter {
+			productFilter[key] = value
+		}
+
+		orderCount, err := ordersCollection.CountDocuments(ctx, bson.M{"$or": []bson.M{
+			{"items.product_id": product.ID},
+			{"items.components.product_id": product.ID},
+		}})
+		if err != nil {
+			return purged, err
+		}
+		if orderCount > 0 {
+			// Not part of the product's representation, so the version
+			// stays the same
+			_, err := productsCollection.UpdateOne(ctx, productFilter, bson.M{"$set": bson.M{"kept_for_orders": true}})
+			if err != nil {
+				return purged, err
+			}
+			continue
+		}
+
+		result, err := productsCollection.DeleteOne(ctx, productFilter)
+		if err != nil {
+			return purged, err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		purged++
+
+		for _, image := range product.Images {
+			if err := deleteImageFiles(ctx, image); err != nil {
+				log.Printf("Failed to delete image %s of product %s: %v", image.ID.Hex(), product.ID.Hex(), err)
+			}
+		}
+		if _, err := priceHistoryCollection.DeleteMany(ctx, bson.M{"product_id": product.ID}); err != nil {
+			log.Printf("Failed to delete price history of product %s: %v", product.ID.Hex(), err)
+		}
+		if _, err := scheduledPricesCollection.DeleteMany(ctx, bson.M{"product_id": product.ID}); err != nil {
+			log.Printf("Failed to delete scheduled prices of product %s: %v", product.ID.Hex(), err)
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/models"
+	"inventory/thumbnail"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultThumbnailSizes     = "small=150,medium=400,large=800"
+	defaultThumbnailMaxPixels = 40_000_000
+	defaultThumbnailWorkers   = 2
+	thumbnailQueueSize        = 100
+)
+
+// thumbnailSizes maps each thumbnail name to the length in pixels of its
+// longer side, from THUMBNAIL_SIZES as a list of name=pixels pairs.
+var thumbnailSizes = parseThumbnailSizes(getEnvOrDefault("THUMBNAIL_SIZES", defaultThumbnailSizes))
+
+// thumbnailMaxPixels is the largest image, in width times height pixels,
+// that thumbnails are made for, from THUMBNAIL_MAX_PIXELS.
+var thumbnailMaxPixels = positiveEnvInt("THUMBNAIL_MAX_PIXELS", defaultThumbnailMaxPixels)
+
+// thumbnailWorkers is how many images are resized at once, from
+// THUMBNAIL_WORKERS.
+var thumbnailWorkers = positiveEnvInt("THUMBNAIL_WORKERS", defaultThumbnailWorkers)
+
+type thumbnailJob struct {
+	productID primitive.ObjectID
+	image     models.ProductImage
+}
+
+var (
+	thumbnailQueue        = make(chan thumbnailJob, thumbnailQueueSize)
+	startThumbnailWorkers sync.Once
+)
+
+func positiveEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnvOrDefault(key, strconv.Itoa(fallback)))
+	if err != nil || value <= 0 {
+		log.Printf("Invalid %s, using %d", key, fallback)
+		return fallback
+	}
+	return value
+}
+
+func parseThumbnailSizes(value string) map[string]int {
+	sizes := map[string]int{}
+	for _, pair := range strings.Split(value, ",") {
+		name, pixels, found := strings.Cut(strings.TrimSpace(pair), "=")
+		size, err := strconv.Atoi(pixels)
+		if !found || name == "" || name == "original" || err != nil || size <= 0 {
+			log.Fatalf("Invalid THUMBNAIL_SIZES entry %q", pair)
+		}
+		sizes[name] = size
+	}
+	return sizes
+}
+
+func thumbnailSizeNames() []string {
+	names := make([]string, 0, len(thumbnailSizes))
+	for name := range thumbnailSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// queueThumbnails hands an uploaded image to the thumbnail workers. When
+// they are too far behind the image is left without thumbnails rather than
+// piling up work.
+func queueThumbnails(productID primitive.ObjectID, image models.ProductImage) {
+	startThumbnailWorkers.Do(func() {
+		for i := 0; i < thumbnailWorkers; i++ {
+			go func() {
+				for job := range thumbnailQueue {
+					generateThumbnails(job.productID, job.image)
+				}
+			}()
+		}
+	})
+
+	select {
+	case thumbnailQueue <- thumbnailJob{productID, image}:
+	default:
+		log.Printf("Thumbnail queue is full, skipping image %s", image.ID.Hex())
+	}
+}
+
+// generateThumbnails stores a resized copy of the image in GridFS for every
+// configured size and records them on the image. It runs on a thumbnail
+// worker after an upload, so failures are only logged.
+func generateThumbnails(productID primitive.ObjectID, image models.ProductImage) {
+	ctx := context.Background()
+
+	if !thumbnail.Supported(image.ContentType) {
+		return
+	}
+
+	stream, err := imagesBucket.OpenDownloadStream(image.ID)
+	if err != nil {
+		log.Printf("Failed to open image %s for thumbnails: %v", image.ID.Hex(), err)
+		return
+	}
+	src, err := thumbnail.Decode(stream, image.ContentType, thumbnailMaxPixels)
+	stream.Close()
+	if err != nil {
+		log.Printf("Failed to decode image %s: %v", image.ID.Hex(), err)
+		return
+	}
+
+	thumbnails := map[string]primitive.ObjectID{}
+	for name, size := range thumbnailSizes {
+		var buf bytes.Buffer
+		if err := thumbnail.Encode(&buf, thumbnail.Resize(src, size), image.ContentType); err != nil {
+			log.Printf("Failed to encode %s thumbnail of image %s: %v", name, image.ID.Hex(), err)
+			continue
+		}
+
+		id := primitive.NewObjectID()
+		err := imagesBucket.UploadFromStreamWithID(
+			id,
+			fmt.Sprintf("%s_%s", name, image.Filename),
+			&buf,
+			options.GridFSUpload().SetMetadata(bson.M{
+				"product_id":   productID,
+				"image_id":     image.ID,
+				"size":         name,
+				"content_type": image.ContentType,
+			}),
+		)
+		if err != nil {
+			log.Printf("Failed to store %s thumbnail of image %s: %v", name, image.ID.Hex(), err)
+			continue
+		}
+		thumbnails[name] = id
+	}
+	if len(thumbnails) == 0 {
+		return
+	}
+
+	// Bump the version so concurrent image list changes do not drop the thumbnails
+	result, err := productsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": productID, "images._id": image.ID},
+		bson.M{"$set": bson.M{"images.$.thumbnails": thumbnails, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+	)
+	if err == nil && result.MatchedCount > 0 {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record thumbnails of image %s: %v", image.ID.Hex(), err)
+	}
+
+	// The image is gone or could not be updated, so drop the orphaned files
+	for _, id := range thumbnails {
+		if err := imagesBucket.DeleteContext(ctx, id); err != nil {
+			log.Printf("Failed to delete orphaned thumbnail %s: %v", id.Hex(), err)
+		}
+	}
+}
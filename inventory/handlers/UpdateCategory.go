@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"inventory/models"
+	"inventory/repository"
+	"net/http"
+)
+
+// UpdateCategory changes a category's fields, attribute schema and place in
+// the tree. Schema changes and moves that would leave products in the
+// category or below it with invalid attributes are rejected with 409, listing
+// the affected products.
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Convert string ID to ObjectID
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	// Check if category exists
+	var existingCategory models.Category
+	err = categoriesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&existingCategory)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Parse update fields
+	var updateFields map[string]interface{}
+	err = json.NewDecoder(r.Body).Decode(&updateFields)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Build update document
+	update := bson.M{}
+
+	if name, ok := updateFields["name"].(string); ok && name != "" && name != existingCategory.Name {
+		// Check if category name already exists
+		count, err := categoriesCollection.CountDocuments(ctx, bson.M{"name": name, "_id": bson.M{"$ne": id}})
+		if err != nil {
+			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if count > 0 {
+			repository.RespondWithError(w, http.StatusConflict, "Category name already exists")
+			return
+		}
+		update["name"] = name
+	}
+	if description, ok := updateFields["description"].(string); ok {
+		update["description"] = description
+	}
+	if rawAttributes, ok := updateFields["attributes"]; ok {
+		// Round-trip through JSON to decode the attribute definitions
+		var attributes []models.AttributeDefinition
+		data, _ := json.Marshal(rawAttributes)
+		if err := json.Unmarshal(data, &attributes); err != nil {
+			repository.RespondWithError(w, http.StatusBadRequest, "Invalid attributes")
+			return
+		}
+		if err := validateAttributeSchema(attributes); err != nil {
+			repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		update["attributes"] = attributes
+	}
+
+	// An explicit slug wins, otherwise renaming regenerates it
+	requestedSlug, _ := updateFields["slug"].(string)
+	if _, renamed := update["name"]; requestedSlug != "" || renamed {
+		name, _ := update["name"].(string)
+		newSlug, err := resolveSlug(ctx, categoriesCollection, requestedSlug, name, id, nil)
+		if err != nil {
+			respondWithSlugError(w, err)
+			return
+		}
+		if newSlug != existingCategory.Slug {
+			update["slug"] = newSlug
+			update["old_slugs"] = renameSlug(existingCategory.OldSlugs, existingCategory.Slug, newSlug)
+		}
+	}
+
+	// Handle moving the category, null moves it to the top level
+	var ancestors []primitive.ObjectID
+	parentValue, moving := updateFields["parent_id"]
+	if moving {
+		ancestors = []primitive.ObjectID{}
+		unset := parentValue == nil
+
+		if parentIDStr, ok := parentValue.(string); ok {
+			parentID, err := primitive.ObjectIDFromHex(parentIDStr)
+			if err != nil {
+				repository.RespondWithError(w, http.StatusBadRequest, "Invalid parent category ID")
+				return
+			}
+
+			var parent models.Category
+			err = categoriesCollection.FindOne(ctx, bson.M{"_id": parentID}).Decode(&parent)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					repository.RespondWithError(w, http.StatusBadRequest, "Parent category not found")
+					return
+				}
+				repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			// A category cannot be moved under itself or its own subcategory
+			if parent.ID == id || containsID(parent.Ancestors, id) {
+				repository.RespondWithError(w, http.StatusBadRequest, "Category cannot be moved under itself")
+				return
+			}
+
+			update["parent_id"] = parent.ID
+			ancestors = append(parent.Ancestors, parent.ID)
+		} else if !unset {
+			repository.RespondWithError(w, http.StatusBadRequest, "Invalid parent category ID")
+			return
+		}
+		update["ancestors"] = ancestors
+	}
+
+	// If no valid fields to update
+	if len(update) == 0 {
+		repository.RespondWithError(w, http.StatusBadRequest, "No valid fields to update")
+		return
+	}
+
+	// Start a session for transaction
+	session, err := Client.StartSession()
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		// Products in the category and below must still fit their schema
+		if _, changed := update["attributes"]; changed || moving {
+			updatedCategory := existingCategory
+			if attributes, ok := update["attributes"].([]models.AttributeDefinition); ok {
+				updatedCategory.Attributes = attributes
+			}
+			if moving {
+				updatedCategory.Ancestors = ancestors
+			}
+			invalid, err := findInvalidatedProducts(sessionContext, updatedCategory)
+			if err != nil {
+				return err
+			}
+			if len(invalid) > 0 {
+				return categorySchemaError{invalid}
+			}
+		}
+
+		categoryUpdate := bson.M{"$set": update}
+		if moving && update["parent_id"] == nil {
+			categoryUpdate["$unset"] = bson.M{"parent_id": ""}
+		}
+		_, err := categoriesCollection.UpdateOne(sessionContext, bson.M{"_id": id}, categoryUpdate)
+		if err != nil {
+			return err
+		}
+
+		// Rewrite the ancestors of every subcategory below the moved one
+		if moving {
+			if err := moveDescendants(sessionContext, id, ancestors); err != nil {
+				return err
+			}
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		// Transaction failed, handle the error
+		session.AbortTransaction(ctx)
+		if schemaErr, ok := err.(categorySchemaError); ok {
+			repository.RespondWithJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":    schemaErr.Error(),
+				"products": schemaErr.products,
+			})
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Get updated category
+	var updatedCategory models.Category
+	err = categoriesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&updatedCategory)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	repository.RespondWithJSON(w, http.StatusOK, updatedCategory)
+}
+
+// maxInvalidProducts caps how many products a rejected schema change lists.
+const maxInvalidProducts = 50
+
+// invalidProduct is a product whose attributes a schema change would
+// invalidate.
+type invalidProduct struct {
+	ID     string       `json:"id"`
+	Error  string       `json:"error"`
+	Fields []fieldError `json:"fields"`
+}
+
+// categorySchemaError rejects a category change that would leave products
+// with attributes that no longer match their schema.
+type categorySchemaError struct {
+	products []invalidProduct
+}
+
+func (e categorySchemaError) Error() string {
+	return "Attribute schema change would invalidate existing products"
+}
+
+// findInvalidatedProducts checks the products in a category and its
+// descendants against the schemas they would have once the category is
+// replaced by updated, returning up to maxInvalidProducts that no longer
+// fit.
+func findInvalidatedProducts(ctx context.Context, updated models.Category) ([]invalidProduct, error) {
+	// Load the new ancestors and the descendants, whose ancestors above the
+	// category follow its new ones
+	cursor, err := categoriesCollection.Find(ctx, bson.M{"$or": []bson.M{
+		{"_id": bson.M{"$in": append([]primitive.ObjectID{}, updated.Ancestors...)}},
+		{"ancestors": updated.ID},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	var related []models.Category
+	err = cursor.All(ctx, &related)
+	cursor.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[primitive.ObjectID]models.Category{updated.ID: updated}
+	categories := []models.Category{updated}
+	for _, category := range related {
+		if i := indexOfID(category.Ancestors, updated.ID); i >= 0 {
+			category.Ancestors = append(append([]primitive.ObjectID{}, updated.Ancestors...), category.Ancestors[i:]...)
+			categories = append(categories, category)
+		}
+		byID[category.ID] = category
+	}
+
+	invalid := []invalidProduct{}
+	for _, category := range categories {
+		chain := []models.Category{}
+		for _, id := range category.Ancestors {
+			if ancestor, ok := byID[id]; ok {
+				chain = append(chain, ancestor)
+			}
+		}
+		schema := mergeSchema(append(chain, category))
+
+		invalid, err = findUnfitProducts(ctx, schema, notDeleted(bson.M{"category_id": category.ID}), invalid)
+		if err != nil {
+			return nil, err
+		}
+		if len(invalid) == maxInvalidProducts {
+			return invalid, nil
+		}
+	}
+	return invalid, nil
+}
+
+// findUnfitProducts appends the products matching filter whose attributes do
+// not fit schema to invalid, up to maxInvalidProducts in total.
+func findUnfitProducts(ctx context.Context, schema []models.AttributeDefinition, filter bson.M, invalid []invalidProduct) ([]invalidProduct, error) {
+	cursor, err := productsCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"attributes": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	err = cursor.All(ctx, &products)
+	cursor.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, product := range products {
+		if errs := validateAttributes(schema, product.Attributes); len(errs) > 0 {
+			invalid = append(invalid, invalidProduct{ID: product.ID.Hex(), Error: fieldErrors(errs).Error(), Fields: errs})
+			if len(invalid) == maxInvalidProducts {
+				break
+			}
+		}
+	}
+	return invalid, nil
+}
+
+// moveDescendants replaces the part of each descendant's ancestors above id
+// with the new ancestors of id.
+func moveDescendants(ctx context.Context, id primitive.ObjectID, ancestors []primitive.ObjectID) error {
+	cursor, err := categoriesCollection.Find(ctx, bson.M{"ancestors": id})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var descendants []models.Category
+	if err := cursor.All(ctx, &descendants); err != nil {
+		return err
+	}
+
+	for _, descendant := range descendants {
+		below := descendant.Ancestors[indexOfID(descendant.Ancestors, id):]
+		newAncestors := append(append([]primitive.ObjectID{}, ancestors...), below...)
+		_, err := categoriesCollection.UpdateOne(ctx, bson.M{"_id": descendant.ID}, bson.M{"$set": bson.M{"ancestors": newAncestors}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	return indexOfID(ids, id) >= 0
+}
+
+func indexOfID(ids []primitive.ObjectID, id primitive.ObjectID) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -3,116 +3,334 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"github.com/gorilla/mux"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/jsonpatch"
 	"inventory/models"
 	"inventory/repository"
+	"mime"
 	"net/http"
+	"reflect"
 	"time"
 )
 
-func UpdateProduct(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	vars := mux.Vars(r)
-	idStr := vars["id"]
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
 
-	// Convert string ID to ObjectID
-	id, err := primitive.ObjectIDFromHex(idStr)
-	if err != nil {
-		repository.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+var errProductChanged = errors.New("Product changed, please retry")
+
+// UpdateProduct applies a patch to a product. The Content-Type selects an
+// RFC 7396 merge patch (application/merge-patch+json, or application/json)
+// or an RFC 6902 JSON patch (application/json-patch+json).
+func UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	// Check if product exists
+	existingProduct, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, existingProduct) {
 		return
 	}
 
-	// Check if product exists
-	var existingProduct models.Product
-	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&existingProduct)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+	// Apply the patch to the product's editable fields
+	var patched interface{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json", mergePatchContentType:
+		var patch interface{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		patched = jsonpatch.Merge(newProductDocument(existingProduct), patch)
+
+	case jsonPatchContentType:
+		var operations []jsonpatch.Operation
+		if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+			repository.RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		var err error
+		patched, err = jsonpatch.Apply(newProductDocument(existingProduct), operations)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			repository.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			repository.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+
+	default:
+		repository.RespondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+mergePatchContentType+" or "+jsonPatchContentType)
 		return
 	}
 
-	// Parse update fields
-	var updateFields map[string]interface{}
-	err = json.NewDecoder(r.Body).Decode(&updateFields)
-	if err != nil {
+	doc, errs := decodeProductDocument(patched, existingProduct)
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	saveProduct(w, r, existingProduct, doc)
+}
+
+// ReplaceProduct replaces all editable fields of a product with the request
+// body. Fields that are left out are cleared.
+func ReplaceProduct(w http.ResponseWriter, r *http.Request) {
+	// Check if product exists
+	existingProduct, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, existingProduct) {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "application/json" {
+		repository.RespondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	var body interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	doc, errs := decodeProductDocument(body, existingProduct)
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	saveProduct(w, r, existingProduct, doc)
+}
+
+// saveProduct writes the changes in doc and responds with the updated
+// product.
+func saveProduct(w http.ResponseWriter, r *http.Request, existingProduct models.Product, doc productDocument) {
+	updatedProduct, err := applyProductDocument(context.Background(), existingProduct, doc, "update")
+	if err == errProductChanged {
+		respondWithProductChanged(w, r)
+		return
+	}
+	if err != nil {
+		respondWithProductError(w, err)
+		return
+	}
+
+	respondWithProduct(w, http.StatusOK, updatedProduct)
+}
+
+// applyProductDocument writes the fields of doc that differ from the
+// existing product after checking the ones that depend on other documents,
+// and returns the updated product. A price change is recorded with the given
+// reason. It fails with errProductChanged if the product was written since
+// it was read.
+func applyProductDocument(ctx context.Context, existingProduct models.Product, doc productDocument, reason string) (models.Product, error) {
+	id := existingProduct.ID
+
+	updateDoc, err := productUpdate(ctx, existingProduct, doc, nil)
+	if err != nil {
+		return existingProduct, err
+	}
+
+	// Nothing changed, so there is nothing to write
+	if updateDoc == nil {
+		return existingProduct, nil
+	}
+	priceChanged := doc.Price != existingProduct.Price
+
+	// Only write over the version that was read and checked
+	filter := bson.M{"_id": id, "version": existingProduct.Version}
+
+	// Start a session for transaction
+	session, err := Client.StartSession()
+	if err != nil {
+		return existingProduct, err
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		result, err := productsCollection.UpdateOne(sessionContext, filter, updateDoc)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errProductChanged
+		}
+
+		// Record the price change
+		if priceChanged {
+			err := recordPriceChange(sessionContext, id, existingProduct.Price, doc.Price, reason, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		// Transaction failed, handle the error
+		session.AbortTransaction(ctx)
+		return existingProduct, err
+	}
+
+	// Get updated product
+	var updatedProduct models.Product
+	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&updatedProduct)
+	return updatedProduct, err
+}
+
+// productUpdate checks the fields of doc that differ from the existing
+// product and returns the update that writes them, or nil if nothing
+// changed. A new slug avoids the reserved ones. Fields that fail the checks
+// against other documents are all reported together as fieldErrors.
+func productUpdate(ctx context.Context, existingProduct models.Product, doc productDocument, reservedSlugs map[string]bool) (bson.M, error) {
+	id := existingProduct.ID
+	errs := fieldErrors{}
+
 	// Build update document
 	update := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
 
-	// Handle each field
-	if name, ok := updateFields["name"].(string); ok && name != "" {
-		update["name"] = name
+	if doc.Name != existingProduct.Name {
+		update["name"] = doc.Name
 	}
-	if description, ok := updateFields["description"].(string); ok {
-		update["description"] = description
+
+	// An explicit slug wins, otherwise renaming or clearing it regenerates it
+	requestedSlug := doc.Slug
+	if requestedSlug == existingProduct.Slug && doc.Name != existingProduct.Name {
+		requestedSlug = ""
 	}
-	if price, ok := updateFields["price"].(float64); ok && price > 0 {
-		update["price"] = price
+	if requestedSlug == "" || requestedSlug != existingProduct.Slug {
+		newSlug, err := resolveSlug(ctx, productsCollection, requestedSlug, doc.Name, id, reservedSlugs)
+		if err == errInvalidSlug || err == errSlugTaken {
+			errs = append(errs, fieldError{"slug", err.Error()})
+		} else if err != nil {
+			return nil, err
+		} else if newSlug != existingProduct.Slug {
+			update["slug"] = newSlug
+			update["old_slugs"] = renameSlug(existingProduct.OldSlugs, existingProduct.Slug, newSlug)
+		}
 	}
-	if stockLevel, ok := updateFields["stock_level"].(float64); ok && stockLevel >= 0 {
-		update["stock_level"] = int(stockLevel)
+	if doc.Description != existingProduct.Description {
+		update["description"] = doc.Description
 	}
-	if categoryIDStr, ok := updateFields["category_id"].(string); ok {
-		// Convert string category ID to ObjectID
-		categoryID, err := primitive.ObjectIDFromHex(categoryIDStr)
-		if err != nil {
-			repository.RespondWithError(w, http.StatusBadRequest, "Invalid category ID")
-			return
+
+	// SKU and barcode are removed when cleared
+	if doc.SKU != existingProduct.SKU || doc.Barcode != existingProduct.Barcode {
+		identifiers := existingProduct
+		identifiers.SKU = doc.SKU
+		identifiers.Barcode = doc.Barcode
+		if err := checkIdentifiers(ctx, identifiers); err != nil {
+			ie, ok := err.(identifierError)
+			if !ok {
+				return nil, err
+			}
+			errs = append(errs, fieldError{ie.field, ie.message})
+		}
+		if doc.SKU != existingProduct.SKU {
+			setOrUnset(update, unset, "sku", doc.SKU)
 		}
+		if doc.Barcode != existingProduct.Barcode {
+			setOrUnset(update, unset, "barcode", doc.Barcode)
+		}
+	}
+
+	if doc.Price != existingProduct.Price {
+		update["price"] = doc.Price
+	}
+	stockLevel := 0
+	if doc.StockLevel != nil {
+		stockLevel = *doc.StockLevel
+	}
+	if stockLevel != existingProduct.StockLevel {
+		update["stock_level"] = stockLevel
+	}
+	if doc.Weight != existingProduct.Weight {
+		update["weight"] = doc.Weight
+	}
+	if doc.Dimensions != existingProduct.Dimensions {
+		update["dimensions"] = doc.Dimensions
+	}
 
+	moved := doc.CategoryID != existingProduct.CategoryID
+	// Compare attributes as JSON, stored numbers may decode as integers
+	existingAttributes, _ := newProductDocument(existingProduct)["attributes"].(map[string]interface{})
+	attributesChanged := !reflect.DeepEqual(doc.Attributes, existingAttributes)
+	if moved || attributesChanged {
 		// Check if category exists
-		var categoryDoc models.Category
-		err = categoriesCollection.FindOne(ctx, bson.M{"_id": categoryID}).Decode(&categoryDoc)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				repository.RespondWithError(w, http.StatusBadRequest, "Category not found")
-				return
+		var category models.Category
+		err := categoriesCollection.FindOne(ctx, bson.M{"_id": doc.CategoryID}).Decode(&category)
+		if err == mongo.ErrNoDocuments {
+			errs = append(errs, fieldError{"category_id", "Category not found"})
+		} else if err != nil {
+			return nil, err
+		} else {
+			// Attributes must fit the (new) category
+			schema, err := categorySchema(ctx, category)
+			if err != nil {
+				return nil, err
 			}
-			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
-			return
+			errs = append(errs, validateAttributes(schema, doc.Attributes)...)
+		}
+	}
+	if moved {
+		update["category_id"] = doc.CategoryID
+	}
+	if attributesChanged {
+		if doc.Attributes == nil {
+			unset["attributes"] = ""
+		} else {
+			update["attributes"] = doc.Attributes
 		}
-
-		update["category_id"] = categoryID
 	}
 
-	// If no valid fields to update
-	if len(update) == 1 { // Only updated_at is set
-		repository.RespondWithError(w, http.StatusBadRequest, "No valid fields to update")
-		return
+	// Components of a bundle must still be valid products
+	if !reflect.DeepEqual(doc.Components, existingProduct.Components) {
+		if err := checkBundleComponents(ctx, id, doc.Components); err != nil {
+			pe, ok := err.(productError)
+			if !ok {
+				return nil, err
+			}
+			errs = append(errs, fieldError{"components", pe.message})
+		}
+		update["components"] = doc.Components
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
-	// Update product
-	result, err := productsCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": id},
-		bson.M{"$set": update},
-	)
-	if err != nil {
-		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+	// Nothing changed, so there is nothing to write
+	if len(update) == 1 && len(unset) == 0 { // Only updated_at is set
+		return nil, nil
 	}
 
-	if result.ModifiedCount == 0 {
-		repository.RespondWithError(w, http.StatusInternalServerError, "Failed to update product")
-		return
+	updateDoc := bson.M{"$set": update, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		updateDoc["$unset"] = unset
 	}
+	return updateDoc, nil
+}
 
-	// Get updated product
-	var updatedProduct models.Product
-	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&updatedProduct)
-	if err != nil {
-		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+// setOrUnset sets field to value, or removes it if value is empty.
+func setOrUnset(set, unset bson.M, field, value string) {
+	if value == "" {
+		unset[field] = ""
 		return
 	}
-
-	repository.RespondWithJSON(w, http.StatusOK, updatedProduct)
+	set[field] = value
 }
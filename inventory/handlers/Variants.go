@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/models"
+	"inventory/repository"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// validateOptions checks that option names and their values are non-empty
+// and unique.
+func validateOptions(options []models.ProductOption) error {
+	names := map[string]bool{}
+	for _, option := range options {
+		if option.Name == "" {
+			return fmt.Errorf("Option name is required")
+		}
+		if names[option.Name] {
+			return fmt.Errorf("Duplicate option %s", option.Name)
+		}
+		names[option.Name] = true
+
+		if len(option.Values) == 0 {
+			return fmt.Errorf("Option %s must have at least one value", option.Name)
+		}
+		values := map[string]bool{}
+		for _, value := range option.Values {
+			if value == "" || values[value] {
+				return fmt.Errorf("Option %s has an empty or duplicate value", option.Name)
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// buildVariants validates the requested variants against the product options
+// and assigns them IDs. Every variant must pick one allowed value for each
+// option, and no two variants may share a combination or SKU.
+func buildVariants(options []models.ProductOption, reqs []models.CreateVariantRequest) ([]models.ProductVariant, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	if len(options) == 0 {
+		return nil, fmt.Errorf("Variants require product options")
+	}
+
+	skus := map[string]bool{}
+	combinations := map[string]bool{}
+	variants := make([]models.ProductVariant, 0, len(reqs))
+	for _, req := range reqs {
+		if req.SKU == "" {
+			return nil, fmt.Errorf("Variant SKU is required")
+		}
+		if skus[req.SKU] {
+			return nil, fmt.Errorf("Duplicate variant SKU %s", req.SKU)
+		}
+		skus[req.SKU] = true
+
+		if req.Price != nil && *req.Price <= 0 {
+			return nil, fmt.Errorf("Price of variant %s must be greater than zero", req.SKU)
+		}
+		if req.StockLevel < 0 {
+			return nil, fmt.Errorf("Stock level of variant %s cannot be negative", req.SKU)
+		}
+
+		combination, err := variantCombination(options, req.SKU, req.Options)
+		if err != nil {
+			return nil, err
+		}
+		if combinations[combination] {
+			return nil, fmt.Errorf("Variant %s duplicates another variant's options", req.SKU)
+		}
+		combinations[combination] = true
+
+		variants = append(variants, models.ProductVariant{
+			ID:         primitive.NewObjectID(),
+			SKU:        req.SKU,
+			Barcode:    req.Barcode,
+			Options:    req.Options,
+			Price:      req.Price,
+			StockLevel: req.StockLevel,
+		})
+	}
+	return variants, nil
+}
+
+// variantCombination checks that values picks one allowed value for every
+// option and returns the combination as a key that identical picks share.
+func variantCombination(options []models.ProductOption, sku string, values map[string]string) (string, error) {
+	if len(values) != len(options) {
+		return "", fmt.Errorf("Variant %s must set a value for every option", sku)
+	}
+
+	allowed := map[string]map[string]bool{}
+	for _, option := range options {
+		allowed[option.Name] = map[string]bool{}
+		for _, value := range option.Values {
+			allowed[option.Name][value] = true
+		}
+	}
+
+	var parts []string
+	for name, value := range values {
+		if !allowed[name][value] {
+			return "", fmt.Errorf("Variant %s has invalid value %q for option %s", sku, value, name)
+		}
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";"), nil
+}
+
+// variantStock returns the total stock of all variants.
+func variantStock(variants []models.ProductVariant) int {
+	total := 0
+	for _, variant := range variants {
+		total += variant.StockLevel
+	}
+	return total
+}
+
+// UpdateVariant changes the price, stock level, SKU, barcode or options of
+// one variant, keeping the product stock level equal to the sum over its
+// variants.
+func UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+
+	// Convert string IDs to ObjectIDs
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+	variantID, err := primitive.ObjectIDFromHex(vars["variant_id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+
+	// Check if product and variant exist
+	var existingProduct models.Product
+	err = productsCollection.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&existingProduct)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			repository.RespondWithError(w, http.StatusNotFound, "Product not found")
+			return
+		}
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	variant := existingProduct.Variant(variantID)
+	if variant == nil {
+		repository.RespondWithError(w, http.StatusNotFound, "Variant not found")
+		return
+	}
+	if !checkIfMatch(w, r, existingProduct) {
+		return
+	}
+
+	// Parse update fields
+	var updateFields map[string]interface{}
+	err = json.NewDecoder(r.Body).Decode(&updateFields)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Build update document
+	set := bson.M{"updated_at": time.Now()}
+	inc := bson.M{"version": 1}
+
+	if price, present := updateFields["price"]; present {
+		if price == nil {
+			// null falls back to the product price
+			set["variants.$.price"] = nil
+		} else if p, ok := price.(float64); ok && p > 0 {
+			set["variants.$.price"] = p
+		} else {
+			repository.RespondWithError(w, http.StatusBadRequest, "Price must be greater than zero")
+			return
+		}
+	}
+	if value, present := updateFields["stock_level"]; present {
+		stockLevel, ok := value.(float64)
+		if !ok || stockLevel < 0 || stockLevel != math.Trunc(stockLevel) {
+			repository.RespondWithError(w, http.StatusBadRequest, "Stock level must be an integer of at least 0")
+			return
+		}
+		set["variants.$.stock_level"] = int(stockLevel)
+		inc["stock_level"] = int(stockLevel) - variant.StockLevel
+	}
+
+	// SKU, barcode and options get the same checks as for a new variant
+	changed := *variant
+	if sku, present := updateFields["sku"]; present {
+		s, ok := sku.(string)
+		if !ok || s == "" {
+			repository.RespondWithError(w, http.StatusBadRequest, "Variant SKU is required")
+			return
+		}
+		changed.SKU = s
+	}
+	if barcode, present := updateFields["barcode"]; present {
+		s, ok := barcode.(string)
+		if !ok && barcode != nil {
+			repository.RespondWithError(w, http.StatusBadRequest, "Invalid barcode")
+			return
+		}
+		changed.Barcode = s
+	}
+	if rawOptions, present := updateFields["options"]; present {
+		values, ok := rawOptions.(map[string]interface{})
+		if !ok {
+			repository.RespondWithError(w, http.StatusBadRequest, "Invalid variant options")
+			return
+		}
+		changed.Options = map[string]string{}
+		for name, value := range values {
+			s, ok := value.(string)
+			if !ok {
+				repository.RespondWithError(w, http.StatusBadRequest, "Invalid variant options")
+				return
+			}
+			changed.Options[name] = s
+		}
+	}
+
+	unset := bson.M{}
+	if changed.SKU != variant.SKU || changed.Barcode != variant.Barcode {
+		candidate := existingProduct
+		candidate.Variants = replaceVariant(existingProduct.Variants, changed)
+		if err := checkIdentifiers(ctx, candidate); err != nil {
+			respondWithIdentifierError(w, err)
+			return
+		}
+		set["variants.$.sku"] = changed.SKU
+		if changed.Barcode == "" {
+			unset["variants.$.barcode"] = ""
+		} else {
+			set["variants.$.barcode"] = changed.Barcode
+		}
+	}
+	if !reflect.DeepEqual(changed.Options, variant.Options) {
+		combination, err := variantCombination(existingProduct.Options, changed.SKU, changed.Options)
+		if err != nil {
+			repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, other := range existingProduct.Variants {
+			if other.ID == variant.ID {
+				continue
+			}
+			if otherCombination, _ := variantCombination(existingProduct.Options, other.SKU, other.Options); otherCombination == combination {
+				repository.RespondWithError(w, http.StatusConflict, fmt.Sprintf("Variant %s duplicates another variant's options", changed.SKU))
+				return
+			}
+		}
+		set["variants.$.options"] = changed.Options
+	}
+
+	if len(set) == 1 && len(unset) == 0 {
+		repository.RespondWithError(w, http.StatusBadRequest, "No valid fields to update")
+		return
+	}
+
+	update := bson.M{"$set": set, "$inc": inc}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	// Only write over the version that was read and checked, so the stock
+	// delta is not applied over an order's change
+	result, err := productsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "version": existingProduct.Version, "variants._id": variantID},
+		update,
+	)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.MatchedCount == 0 {
+		respondWithProductChanged(w, r)
+		return
+	}
+
+	// Get updated product
+	var updatedProduct models.Product
+	err = productsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&updatedProduct)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithProduct(w, http.StatusOK, updatedProduct)
+}
+
+// AddVariant adds a variant to a product. The first variant of a product
+// takes over its stock level, which from then on is the sum over the
+// variants.
+func AddVariant(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, product) {
+		return
+	}
+	if product.Type == models.ProductTypeBundle {
+		repository.RespondWithError(w, http.StatusBadRequest, "Bundles cannot have variants")
+		return
+	}
+
+	var req models.CreateVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate the new variant together with the existing ones
+	reqs := make([]models.CreateVariantRequest, 0, len(product.Variants)+1)
+	for _, variant := range product.Variants {
+		reqs = append(reqs, models.CreateVariantRequest{
+			SKU:        variant.SKU,
+			Barcode:    variant.Barcode,
+			Options:    variant.Options,
+			Price:      variant.Price,
+			StockLevel: variant.StockLevel,
+		})
+	}
+	variants, err := buildVariants(product.Options, append(reqs, req))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	variant := variants[len(variants)-1]
+
+	// Check SKUs and barcodes
+	candidate := product
+	candidate.Variants = append(append([]models.ProductVariant{}, product.Variants...), variant)
+	if err := checkIdentifiers(ctx, candidate); err != nil {
+		respondWithIdentifierError(w, err)
+		return
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	inc := bson.M{"version": 1}
+	if len(product.Variants) == 0 {
+		// Bundles include products with variants by variant
+		count, err := productsCollection.CountDocuments(ctx, notDeleted(bson.M{
+			"components": bson.M{"$elemMatch": bson.M{"product_id": product.ID, "variant_id": bson.M{"$exists": false}}},
+		}))
+		if err != nil {
+			repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if count > 0 {
+			repository.RespondWithError(w, http.StatusConflict, "Product is part of a bundle that does not name a variant")
+			return
+		}
+		set["stock_level"] = variant.StockLevel
+	} else {
+		inc["stock_level"] = variant.StockLevel
+	}
+
+	updateVariantProduct(w, r, product, bson.M{"$push": bson.M{"variants": variant}, "$set": set, "$inc": inc}, http.StatusCreated)
+}
+
+// DeleteVariant removes a variant and its stock from a product.
+func DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, product) {
+		return
+	}
+	variantID, err := primitive.ObjectIDFromHex(mux.Vars(r)["variant_id"])
+	if err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+	variant := product.Variant(variantID)
+	if variant == nil {
+		repository.RespondWithError(w, http.StatusNotFound, "Variant not found")
+		return
+	}
+
+	// Bundles refer to variants by ID
+	count, err := productsCollection.CountDocuments(ctx, notDeleted(bson.M{
+		"components": bson.M{"$elemMatch": bson.M{"product_id": product.ID, "variant_id": variantID}},
+	}))
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		repository.RespondWithError(w, http.StatusConflict, "Variant is part of a bundle")
+		return
+	}
+
+	updateVariantProduct(w, r, product, bson.M{
+		"$pull": bson.M{"variants": bson.M{"_id": variantID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+		"$inc":  bson.M{"version": 1, "stock_level": -variant.StockLevel},
+	}, http.StatusOK)
+}
+
+// UpdateProductOptions replaces a product's options. Every variant must
+// still pick one allowed value for each option, so values in use cannot be
+// removed and options cannot be added while the product has variants.
+func UpdateProductOptions(w http.ResponseWriter, r *http.Request) {
+	product, ok := findRequestProduct(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, product) {
+		return
+	}
+	if product.Type == models.ProductTypeBundle {
+		repository.RespondWithError(w, http.StatusBadRequest, "Bundles cannot have options")
+		return
+	}
+
+	var options []models.ProductOption
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateOptions(options); err != nil {
+		repository.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(options) == 0 && len(product.Variants) > 0 {
+		repository.RespondWithError(w, http.StatusConflict, "Variants require product options")
+		return
+	}
+	for _, variant := range product.Variants {
+		if _, err := variantCombination(options, variant.SKU, variant.Options); err != nil {
+			repository.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+	}
+
+	update := bson.M{"$set": bson.M{"options": options, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}}
+	if len(options) == 0 {
+		update["$set"] = bson.M{"updated_at": time.Now()}
+		update["$unset"] = bson.M{"options": ""}
+	}
+	updateVariantProduct(w, r, product, update, http.StatusOK)
+}
+
+// updateVariantProduct writes an update over the version of the product that
+// was read and responds with the updated product.
+func updateVariantProduct(w http.ResponseWriter, r *http.Request, product models.Product, update bson.M, status int) {
+	ctx := context.Background()
+
+	result, err := productsCollection.UpdateOne(ctx, bson.M{"_id": product.ID, "version": product.Version}, update)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.MatchedCount == 0 {
+		respondWithProductChanged(w, r)
+		return
+	}
+
+	// Get updated product
+	var updatedProduct models.Product
+	err = productsCollection.FindOne(ctx, bson.M{"_id": product.ID}).Decode(&updatedProduct)
+	if err != nil {
+		repository.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithProduct(w, status, updatedProduct)
+}
+
+// replaceVariant returns a copy of variants with the one sharing changed's ID
+// replaced by it.
+func replaceVariant(variants []models.ProductVariant, changed models.ProductVariant) []models.ProductVariant {
+	result := make([]models.ProductVariant, len(variants))
+	for i, variant := range variants {
+		if variant.ID == changed.ID {
+			variant = changed
+		}
+		result[i] = variant
+	}
+	return result
+}
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"context"
+	"inventory/config"
+	"inventory/handlers"
+	"time"
+)
+
+var priceSchedule = config.NewJob(
+	"price_schedule",
+	"scheduled_prices_applied_total",
+	config.GetDuration("PRICE_SCHEDULE_INTERVAL", time.Minute),
+	handlers.ApplyScheduledPrices,
+	"Applied %d scheduled price changes",
+	"Failed to apply scheduled prices",
+)
+
+// RunPriceSchedule starts and ends scheduled prices every
+// PRICE_SCHEDULE_INTERVAL (default one minute) until ctx is done.
+func RunPriceSchedule(ctx context.Context) {
+	priceSchedule.Run(ctx)
+}
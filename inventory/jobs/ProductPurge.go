@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"inventory/config"
+	"inventory/handlers"
+	"time"
+)
+
+var (
+	productRetention = config.GetDuration("PRODUCT_RETENTION", 30*24*time.Hour)
+	productPurge     = config.NewJob(
+		"product_purge",
+		"products_purged_total",
+		config.GetDuration("PRODUCT_PURGE_INTERVAL", time.Hour),
+		purgeProducts,
+		"Purged %d deleted products",
+		"Failed to purge deleted products",
+	)
+)
+
+// RunProductPurge permanently removes products deleted longer than
+// PRODUCT_RETENTION (default 30 days) ago every PRODUCT_PURGE_INTERVAL
+// (default one hour) until ctx is done.
+func RunProductPurge(ctx context.Context) {
+	productPurge.Run(ctx)
+}
+
+func purgeProducts(ctx context.Context, now time.Time) (int, error) {
+	return handlers.PurgeDeletedProducts(ctx, now.Add(-productRetention))
+}
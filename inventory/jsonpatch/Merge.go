@@ -0,0 +1,27 @@
+package jsonpatch
+
+// Merge applies an RFC 7396 merge patch to a decoded JSON document and
+// returns the result. Objects are merged recursively, null removes a member
+// and any other value replaces the target. The target is not modified.
+func Merge(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	result := map[string]interface{}{}
+	if targetObject, ok := target.(map[string]interface{}); ok {
+		for key, value := range targetObject {
+			result[key] = value
+		}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = Merge(result[key], value)
+	}
+	return result
+}
@@ -0,0 +1,199 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`},
+		{"add null", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`},
+		{"add nested", `{"a":{"b":1}}`, `[{"op":"add","path":"/a/c","value":2}]`, `{"a":{"b":1,"c":2}}`},
+		{"add array insert", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"add array index at length", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`},
+		{"add array end", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove array element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`},
+		{"replace array element", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":3}]`, `{"a":[3,2]}`},
+		{"replace whole document", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`},
+		{"move member", `{"a":1,"b":{}}`, `[{"op":"move","from":"/a","path":"/b/c"}]`, `{"b":{"c":1}}`},
+		{"move array element", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`},
+		{"copy member", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{"copy is independent", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test passes", `{"a":[1,{"b":"x"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"x"}]}]`, `{"a":[1,{"b":"x"}]}`},
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escaped tilde", `{"a~b":1}`, `[{"op":"remove","path":"/a~0b"}]`, `{}`},
+		{"escape order", `{"~1":1}`, `[{"op":"add","path":"/~01","value":2}]`, `{"~1":2}`},
+		{"empty member name", `{"":1}`, `[{"op":"replace","path":"/","value":2}]`, `{"":2}`},
+		{"numeric member name", `{"01":1}`, `[{"op":"remove","path":"/01"}]`, `{}`},
+		{"operations in order", `{}`, `[{"op":"add","path":"/a","value":[]},{"op":"add","path":"/a/-","value":1},{"op":"test","path":"/a/0","value":1}]`, `{"a":[1]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := decode(t, tt.doc)
+			got, err := Apply(doc, decodeOperations(t, tt.patch))
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply() = %v, want %v", got, want)
+			}
+			if original := decode(t, tt.doc); !reflect.DeepEqual(doc, original) {
+				t.Errorf("Apply() modified the document to %v", doc)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{"unknown op", `{}`, `[{"op":"merge","path":"/a","value":1}]`},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`},
+		{"invalid pointer", `{}`, `[{"op":"add","path":"a","value":1}]`},
+		{"add missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`},
+		{"add past array end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`},
+		{"add into scalar", `{"a":1}`, `[{"op":"add","path":"/a/b","value":2}]`},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`},
+		{"remove array end", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`},
+		{"remove out of range", `{"a":[1]}`, `[{"op":"remove","path":"/a/1"}]`},
+		{"remove whole document", `{"a":1}`, `[{"op":"remove","path":""}]`},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`},
+		{"replace array end", `{"a":[1]}`, `[{"op":"replace","path":"/a/-","value":2}]`},
+		{"move missing from", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`},
+		{"move into itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`},
+		{"copy missing from", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`},
+		{"test missing member", `{}`, `[{"op":"test","path":"/a","value":null}]`},
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/01","value":3}]`},
+		{"leading zero add index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/00","value":3}]`},
+		{"negative index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/-1"}]`},
+		{"non-numeric index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/x"}]`},
+		{"empty index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/"}]`},
+		{"later operation fails", `{"a":1}`, `[{"op":"remove","path":"/a"},{"op":"remove","path":"/a"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := decode(t, tt.doc)
+			if got, err := Apply(doc, decodeOperations(t, tt.patch)); err == nil {
+				t.Errorf("Apply() = %v, want an error", got)
+			}
+			if original := decode(t, tt.doc); !reflect.DeepEqual(doc, original) {
+				t.Errorf("Apply() modified the document to %v", doc)
+			}
+		})
+	}
+}
+
+func TestApplyTestFailed(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		value string
+	}{
+		{"different number", `{"a":1}`, `2`},
+		{"different type", `{"a":1}`, `"1"`},
+		{"null against value", `{"a":1}`, `null`},
+		{"different array order", `{"a":[1,2]}`, `[2,1]`},
+		{"extra member", `{"a":{"b":1}}`, `{"b":1,"c":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := []Operation{{Op: "test", Path: "/a", Value: json.RawMessage(tt.value)}}
+			if _, err := Apply(decode(t, tt.doc), ops); !errors.Is(err, ErrTestFailed) {
+				t.Errorf("Apply() error = %v, want %v", err, ErrTestFailed)
+			}
+		})
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/a/b", []string{"a", "b"}},
+		{"/a~1b", []string{"a/b"}},
+		{"/m~0n", []string{"m~n"}},
+		{"/~01", []string{"~1"}},
+		{"/~10", []string{"/0"}},
+		{"/a//b", []string{"a", "", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			got, err := parsePointer(tt.pointer)
+			if err != nil {
+				t.Fatalf("parsePointer() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePointer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parsePointer("a/b"); err == nil {
+		t.Error("parsePointer() accepted a pointer without a leading slash")
+	}
+}
+
+func TestArrayIndex(t *testing.T) {
+	tests := []struct {
+		token  string
+		length int
+		end    bool
+		want   int
+		ok     bool
+	}{
+		{"0", 2, false, 0, true},
+		{"1", 2, false, 1, true},
+		{"2", 2, false, 0, false},
+		{"2", 2, true, 2, true},
+		{"3", 2, true, 0, false},
+		{"-", 2, true, 2, true},
+		{"-", 2, false, 0, false},
+		{"01", 2, false, 0, false},
+		{"00", 2, true, 0, false},
+		{"-1", 2, false, 0, false},
+		{"", 2, false, 0, false},
+		{"1.0", 2, false, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := arrayIndex(tt.token, tt.length, tt.end)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("arrayIndex(%q, %d, %v) = %d, %v", tt.token, tt.length, tt.end, got, err)
+		}
+	}
+}
+
+func decode(t *testing.T, doc string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(doc), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func decodeOperations(t *testing.T, patch string) []Operation {
+	t.Helper()
+	var ops []Operation
+	if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
@@ -3,9 +3,12 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"github.com/gorilla/mux"
 	"inventory/handlers"
+	inventoryjobs "inventory/jobs"
+	"inventory/order-service/jobs"
 	"log"
 	"net/http"
 	"os"
@@ -16,24 +19,67 @@ func main() {
 	handlers.InitMongo(ctx)
 	defer handlers.Client.Disconnect(ctx)
 
+	// Background jobs
+	go jobs.RunOrderExpiry(ctx)
+	go inventoryjobs.RunPriceSchedule(ctx)
+	go inventoryjobs.RunProductPurge(ctx)
+
 	r := mux.NewRouter()
 
 	// Product endpoints
 	r.HandleFunc("/products", handlers.GetProducts).Methods("GET")
 	r.HandleFunc("/products", handlers.CreateProduct).Methods("POST")
+	r.HandleFunc("/products/search", handlers.SearchProducts).Methods("GET")
+	r.HandleFunc("/products/facets", handlers.GetProductFacets).Methods("GET")
+	r.HandleFunc("/products/batch", handlers.BatchProducts).Methods("POST")
+	r.HandleFunc("/products/export", handlers.ExportProducts).Methods("GET")
+	r.HandleFunc("/products/import", handlers.ImportProducts).Methods("POST")
+	r.HandleFunc("/products/import/{job_id}", handlers.GetImportJob).Methods("GET")
+	r.HandleFunc("/products/import/{job_id}/errors", handlers.GetImportErrors).Methods("GET")
+	r.HandleFunc("/products/by-slug/{slug}", handlers.GetProductBySlug).Methods("GET")
+	r.HandleFunc("/products/by-sku/{sku}", handlers.GetProductBySKU).Methods("GET")
+	r.HandleFunc("/products/by-barcode/{barcode}", handlers.GetProductByBarcode).Methods("GET")
 	r.HandleFunc("/products/{id}", handlers.GetProduct).Methods("GET")
 	r.HandleFunc("/products/{id}", handlers.UpdateProduct).Methods("PATCH")
+	r.HandleFunc("/products/{id}", handlers.ReplaceProduct).Methods("PUT")
 	r.HandleFunc("/products/{id}", handlers.DeleteProduct).Methods("DELETE")
+	r.HandleFunc("/products/{id}/restore", handlers.RestoreProduct).Methods("POST")
+	r.HandleFunc("/products/{id}/options", handlers.UpdateProductOptions).Methods("PUT")
+	r.HandleFunc("/products/{id}/variants", handlers.AddVariant).Methods("POST")
+	r.HandleFunc("/products/{id}/variants/{variant_id}", handlers.UpdateVariant).Methods("PATCH")
+	r.HandleFunc("/products/{id}/variants/{variant_id}", handlers.DeleteVariant).Methods("DELETE")
+	r.HandleFunc("/products/{id}/price-history", handlers.GetPriceHistory).Methods("GET")
+	r.HandleFunc("/products/{id}/scheduled-prices", handlers.GetScheduledPrices).Methods("GET")
+	r.HandleFunc("/products/{id}/scheduled-prices", handlers.CreateScheduledPrice).Methods("POST")
+	r.HandleFunc("/products/{id}/scheduled-prices/{schedule_id}", handlers.CancelScheduledPrice).Methods("DELETE")
+	r.HandleFunc("/products/{id}/images", handlers.GetProductImages).Methods("GET")
+	r.HandleFunc("/products/{id}/images", handlers.UploadProductImage).Methods("POST")
+	r.HandleFunc("/products/{id}/images/{image_id}", handlers.DownloadProductImage).Methods("GET")
+	r.HandleFunc("/products/{id}/images/{image_id}", handlers.UpdateProductImage).Methods("PATCH")
+	r.HandleFunc("/products/{id}/images/{image_id}", handlers.DeleteProductImage).Methods("DELETE")
 
 	// Category endpoints
 	r.HandleFunc("/categories", handlers.GetCategories).Methods("GET")
 	r.HandleFunc("/categories", handlers.CreateCategory).Methods("POST")
+	r.HandleFunc("/categories/tree", handlers.GetCategoryTree).Methods("GET")
+	r.HandleFunc("/categories/by-slug/{slug}", handlers.GetCategoryBySlug).Methods("GET")
+	r.HandleFunc("/categories/{id}", handlers.GetCategory).Methods("GET")
+	r.HandleFunc("/categories/{id}", handlers.UpdateCategory).Methods("PATCH")
+	r.HandleFunc("/categories/{id}", handlers.DeleteCategory).Methods("DELETE")
 
 	// Order endpoints
 	r.HandleFunc("/orders", handlers.GetOrders).Methods("GET")
 	r.HandleFunc("/orders", handlers.CreateOrder).Methods("POST")
+	r.HandleFunc("/orders/shipping-quote", handlers.QuoteShipping).Methods("POST")
 	r.HandleFunc("/orders/{id}", handlers.GetOrder).Methods("GET")
 	r.HandleFunc("/orders/{id}", handlers.UpdateOrderStatus).Methods("PATCH")
+	r.HandleFunc("/orders/{id}/payment", handlers.AuthorizePayment).Methods("POST")
+	r.HandleFunc("/orders/{id}/payment/capture", handlers.CapturePayment).Methods("POST")
+	r.HandleFunc("/orders/{id}/payment/void", handlers.VoidPayment).Methods("POST")
+	r.HandleFunc("/orders/{id}/payment/refund", handlers.RefundPayment).Methods("POST")
+
+	// Metrics
+	r.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -0,0 +1,18 @@
+package models
+
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+// AttributeDefinition describes one product attribute a category expects,
+// e.g. RAM as a number in GB.
+type AttributeDefinition struct {
+	Name     string   `json:"name" bson:"name"`
+	Type     string   `json:"type" bson:"type"`
+	Unit     string   `json:"unit,omitempty" bson:"unit,omitempty"`
+	Required bool     `json:"required" bson:"required"`
+	Values   []string `json:"values,omitempty" bson:"values,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "encoding/json"
+
+// BatchProductsRequest lists product operations to run together. In
+// transactional mode either every operation is applied or none is.
+type BatchProductsRequest struct {
+	Transactional bool             `json:"transactional"`
+	Operations    []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is one "create", "update" or "delete" of a batch. Product
+// holds a CreateProductRequest for creates and a merge patch for updates.
+// Version, when set, must match the product's current version.
+type BatchOperation struct {
+	Op      string          `json:"op"`
+	ID      string          `json:"id,omitempty"`
+	Version *int64          `json:"version,omitempty"`
+	Product json.RawMessage `json:"product,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ProductTypeBundle marks a product made of other products. A bundle holds
+// no stock of its own, it is available as often as its components are.
+const ProductTypeBundle = "bundle"
+
+// BundleComponent is a product, or one of its variants, and how many of it
+// one bundle contains.
+type BundleComponent struct {
+	ProductID primitive.ObjectID  `json:"product_id" bson:"product_id"`
+	VariantID *primitive.ObjectID `json:"variant_id,omitempty" bson:"variant_id,omitempty"`
+	Quantity  int                 `json:"quantity" bson:"quantity"`
+}
@@ -3,7 +3,13 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Category struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name"`
-	Description string             `json:"description" bson:"description"`
+	ID           primitive.ObjectID    `json:"id" bson:"_id,omitempty"`
+	Name         string                `json:"name" bson:"name"`
+	Slug         string                `json:"slug" bson:"slug,omitempty"`
+	OldSlugs     []string              `json:"-" bson:"old_slugs,omitempty"`
+	Description  string                `json:"description" bson:"description"`
+	ParentID     *primitive.ObjectID   `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	Ancestors    []primitive.ObjectID  `json:"ancestors" bson:"ancestors"`
+	Attributes   []AttributeDefinition `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	ProductCount int64                 `json:"product_count" bson:"-"`
 }
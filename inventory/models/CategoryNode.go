@@ -0,0 +1,8 @@
+package models
+
+// CategoryNode is a category with its subcategories, as returned by the
+// category tree endpoint.
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
@@ -1,9 +1,19 @@
 package models
 
 type CreateProductRequest struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	StockLevel  int     `json:"stock_level"`
-	CategoryID  string  `json:"category_id"`
+	Name        string                 `json:"name"`
+	Slug        string                 `json:"slug"`
+	SKU         string                 `json:"sku"`
+	Barcode     string                 `json:"barcode"`
+	Description string                 `json:"description"`
+	Price       float64                `json:"price"`
+	StockLevel  int                    `json:"stock_level"`
+	Weight      float64                `json:"weight"`
+	Dimensions  Dimensions             `json:"dimensions"`
+	CategoryID  string                 `json:"category_id"`
+	Options     []ProductOption        `json:"options"`
+	Variants    []CreateVariantRequest `json:"variants"`
+	Type        string                 `json:"type"`
+	Components  []BundleComponent      `json:"components"`
+	Attributes  map[string]interface{} `json:"attributes"`
 }
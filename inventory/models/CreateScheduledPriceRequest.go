@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type CreateScheduledPriceRequest struct {
+	Price    float64    `json:"price"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
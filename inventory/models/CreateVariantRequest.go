@@ -0,0 +1,9 @@
+package models
+
+type CreateVariantRequest struct {
+	SKU        string            `json:"sku"`
+	Barcode    string            `json:"barcode"`
+	Options    map[string]string `json:"options"`
+	Price      *float64          `json:"price"`
+	StockLevel int               `json:"stock_level"`
+}
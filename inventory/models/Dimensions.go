@@ -0,0 +1,16 @@
+package models
+
+// VolumetricDivisor converts cubic centimetres to billable kilograms.
+const VolumetricDivisor = 5000
+
+type Dimensions struct {
+	Length float64 `json:"length" bson:"length"`
+	Width  float64 `json:"width" bson:"width"`
+	Height float64 `json:"height" bson:"height"`
+}
+
+// VolumetricWeight returns the dimensional weight in kilograms for
+// dimensions given in centimetres.
+func (d Dimensions) VolumetricWeight() float64 {
+	return d.Length * d.Width * d.Height / VolumetricDivisor
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ImportJob tracks a bulk product import. Status moves from "queued" to
+// "running" and ends as "completed" or "failed"; Error explains a failed
+// job, while problems with single rows are kept as ImportRowErrors.
+type ImportJob struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Format        string             `json:"format" bson:"format"`
+	Status        string             `json:"status" bson:"status"`
+	TotalRows     int                `json:"total_rows" bson:"total_rows"`
+	ProcessedRows int                `json:"processed_rows" bson:"processed_rows"`
+	Created       int                `json:"created" bson:"created"`
+	Updated       int                `json:"updated" bson:"updated"`
+	Failed        int                `json:"failed" bson:"failed"`
+	Error         string             `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	StartedAt     *time.Time         `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt    *time.Time         `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ImportRowError records why one row of an import was rejected. Row is the
+// line number in the imported file.
+type ImportRowError struct {
+	ID      primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	JobID   primitive.ObjectID `json:"-" bson:"job_id"`
+	Row     int                `json:"row" bson:"row"`
+	SKU     string             `json:"sku,omitempty" bson:"sku,omitempty"`
+	Message string             `json:"message" bson:"message"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// PriceChange records one change of a product's price. Reason is "update"
+// for manual changes, "import" for bulk imports, "scheduled" when a
+// scheduled price starts and "schedule_ended" when a sale ends and the
+// previous price returns.
+type PriceChange struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID  primitive.ObjectID  `json:"product_id" bson:"product_id"`
+	OldPrice   float64             `json:"old_price" bson:"old_price"`
+	NewPrice   float64             `json:"new_price" bson:"new_price"`
+	Reason     string              `json:"reason" bson:"reason"`
+	ScheduleID *primitive.ObjectID `json:"schedule_id,omitempty" bson:"schedule_id,omitempty"`
+	ChangedAt  time.Time           `json:"changed_at" bson:"changed_at"`
+}
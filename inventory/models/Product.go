@@ -6,12 +6,35 @@ import (
 )
 
 type Product struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name"`
-	Description string             `json:"description" bson:"description"`
-	Price       float64            `json:"price" bson:"price"`
-	StockLevel  int                `json:"stock_level" bson:"stock_level"`
-	CategoryID  primitive.ObjectID `json:"category_id" bson:"category_id"`
-	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	ID          primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Name        string                 `json:"name" bson:"name"`
+	Slug        string                 `json:"slug" bson:"slug,omitempty"`
+	SKU         string                 `json:"sku,omitempty" bson:"sku,omitempty"`
+	Barcode     string                 `json:"barcode,omitempty" bson:"barcode,omitempty"`
+	OldSlugs    []string               `json:"-" bson:"old_slugs,omitempty"`
+	Description string                 `json:"description" bson:"description"`
+	Price       float64                `json:"price" bson:"price"`
+	StockLevel  int                    `json:"stock_level" bson:"stock_level"`
+	Weight      float64                `json:"weight" bson:"weight"`
+	Dimensions  Dimensions             `json:"dimensions" bson:"dimensions"`
+	CategoryID  primitive.ObjectID     `json:"category_id" bson:"category_id"`
+	Options     []ProductOption        `json:"options,omitempty" bson:"options,omitempty"`
+	Variants    []ProductVariant       `json:"variants,omitempty" bson:"variants,omitempty"`
+	Type        string                 `json:"type,omitempty" bson:"type,omitempty"`
+	Components  []BundleComponent      `json:"components,omitempty" bson:"components,omitempty"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	Images      []ProductImage         `json:"images,omitempty" bson:"images,omitempty"`
+	CreatedAt   time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at" bson:"updated_at"`
+	Version     int64                  `json:"version" bson:"version"`
+	DeletedAt   *time.Time             `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// ShippingWeight returns the billable weight: the greater of the actual
+// weight and the volumetric weight.
+func (p Product) ShippingWeight() float64 {
+	if v := p.Dimensions.VolumetricWeight(); v > p.Weight {
+		return v
+	}
+	return p.Weight
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ProductImage describes an image stored in GridFS. ID is the GridFS file ID
+// and images are kept in display order. Thumbnails maps each generated size
+// to the GridFS file ID of the resized copy.
+type ProductImage struct {
+	ID          primitive.ObjectID            `json:"id" bson:"_id"`
+	URL         string                        `json:"url" bson:"url"`
+	Filename    string                        `json:"filename" bson:"filename"`
+	ContentType string                        `json:"content_type" bson:"content_type"`
+	Size        int64                         `json:"size" bson:"size"`
+	Primary     bool                          `json:"primary" bson:"primary"`
+	Thumbnails  map[string]primitive.ObjectID `json:"thumbnails,omitempty" bson:"thumbnails,omitempty"`
+	UploadedAt  time.Time                     `json:"uploaded_at" bson:"uploaded_at"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// ProductOption is a dimension a product varies along, e.g. size with the
+// values S, M and L.
+type ProductOption struct {
+	Name   string   `json:"name" bson:"name"`
+	Values []string `json:"values" bson:"values"`
+}
@@ -0,0 +1,7 @@
+package models
+
+type ProductSearchResult struct {
+	Product    `bson:",inline"`
+	Score      float64           `json:"score" bson:"score"`
+	Highlights map[string]string `json:"highlights,omitempty" bson:"-"`
+}
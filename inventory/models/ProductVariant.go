@@ -0,0 +1,32 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ProductVariant is one purchasable combination of a product's options. A
+// nil Price means the variant sells at the product price.
+type ProductVariant struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	SKU        string             `json:"sku" bson:"sku"`
+	Barcode    string             `json:"barcode,omitempty" bson:"barcode,omitempty"`
+	Options    map[string]string  `json:"options" bson:"options"`
+	Price      *float64           `json:"price,omitempty" bson:"price,omitempty"`
+	StockLevel int                `json:"stock_level" bson:"stock_level"`
+}
+
+// Variant returns the variant with the given ID, or nil if there is none.
+func (p Product) Variant(id primitive.ObjectID) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// VariantPrice returns the price a variant sells at.
+func (p Product) VariantPrice(v ProductVariant) float64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return p.Price
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ScheduledPrice is a future price for a product. Without EndsAt the price
+// simply replaces the current one at StartsAt ("scheduled" -> "applied").
+// With EndsAt it is a sale: the price is active until EndsAt and then the
+// previous price returns ("scheduled" -> "active" -> "ended").
+type ScheduledPrice struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductID     primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Price         float64            `json:"price" bson:"price"`
+	StartsAt      time.Time          `json:"starts_at" bson:"starts_at"`
+	EndsAt        *time.Time         `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	Status        string             `json:"status" bson:"status"`
+	PreviousPrice float64            `json:"previous_price,omitempty" bson:"previous_price,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
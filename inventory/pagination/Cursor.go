@@ -0,0 +1,43 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a sorted result set by the sort field values
+// and _id of a document. A Before cursor selects the page preceding that
+// document rather than the one following it.
+type Cursor struct {
+	Sort   string             `bson:"s"`
+	Values []bson.RawValue    `bson:"v"`
+	ID     primitive.ObjectID `bson:"id"`
+	Before bool               `bson:"b,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c Cursor) Encode() (string, error) {
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode.
+func DecodeCursor(token string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(data, &c); err != nil || c.Sort == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
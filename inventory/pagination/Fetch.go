@@ -0,0 +1,235 @@
+package pagination
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Query describes one page of a keyset-paginated list.
+type Query struct {
+	Limit        int
+	Sort         Sort
+	Cursor       *Cursor
+	IncludeTotal bool
+}
+
+type Page struct {
+	Limit      int    `json:"limit"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// ParseQuery reads the limit, cursor and include_total query parameters.
+func ParseQuery(values url.Values, sort Sort) (Query, error) {
+	query := Query{Limit: DefaultLimit, Sort: sort}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %s", limitStr)
+		}
+		if limit > MaxLimit {
+			limit = MaxLimit
+		}
+		query.Limit = limit
+	}
+
+	if token := values.Get("cursor"); token != "" {
+		cursor, err := DecodeCursor(token)
+		if err != nil {
+			return query, err
+		}
+		if cursor.Sort != sort.String() || len(cursor.Values) != len(sort) {
+			return query, ErrInvalidCursor
+		}
+		query.Cursor = &cursor
+	}
+
+	if totalStr := values.Get("include_total"); totalStr != "" {
+		includeTotal, err := strconv.ParseBool(totalStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid include_total: %s", totalStr)
+		}
+		query.IncludeTotal = includeTotal
+	}
+
+	return query, nil
+}
+
+// Fetch runs a paginated query on coll and decodes the page into results,
+// which must be a pointer to a slice.
+func Fetch(ctx context.Context, coll *mongo.Collection, filter bson.M, query Query, results interface{}) (Page, error) {
+	count := func() (int64, error) {
+		return coll.CountDocuments(ctx, filter)
+	}
+	find := func(sort Sort, after bson.M) ([]bson.Raw, error) {
+		if after != nil {
+			filter = bson.M{"$and": []bson.M{filter, after}}
+		}
+		opts := options.Find().SetSort(sort.Keys()).SetLimit(int64(query.Limit + 1))
+		cursor, err := coll.Find(ctx, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var docs []bson.Raw
+		err = cursor.All(ctx, &docs)
+		return docs, err
+	}
+	return fetchPage(query, count, find, results)
+}
+
+// Aggregate is Fetch for the documents an aggregation pipeline returns, so
+// pages can be sorted and cut by fields the pipeline computes.
+func Aggregate(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, query Query, results interface{}) (Page, error) {
+	stages := func(extra ...bson.D) mongo.Pipeline {
+		return append(append(mongo.Pipeline{}, pipeline...), extra...)
+	}
+	count := func() (int64, error) {
+		cursor, err := coll.Aggregate(ctx, stages(bson.D{{Key: "$count", Value: "total"}}))
+		if err != nil {
+			return 0, err
+		}
+		defer cursor.Close(ctx)
+
+		var counts []struct {
+			Total int64 `bson:"total"`
+		}
+		if err := cursor.All(ctx, &counts); err != nil || len(counts) == 0 {
+			return 0, err
+		}
+		return counts[0].Total, nil
+	}
+	find := func(sort Sort, after bson.M) ([]bson.Raw, error) {
+		var extra []bson.D
+		if after != nil {
+			extra = append(extra, bson.D{{Key: "$match", Value: after}})
+		}
+		extra = append(extra,
+			bson.D{{Key: "$sort", Value: sort.Keys()}},
+			bson.D{{Key: "$limit", Value: int64(query.Limit + 1)}},
+		)
+		cursor, err := coll.Aggregate(ctx, stages(extra...))
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var docs []bson.Raw
+		err = cursor.All(ctx, &docs)
+		return docs, err
+	}
+	return fetchPage(query, count, find, results)
+}
+
+// fetchPage builds a page from find, which returns up to query.Limit+1
+// documents in sort order after the given condition, if any.
+func fetchPage(query Query, count func() (int64, error), find func(sort Sort, after bson.M) ([]bson.Raw, error), results interface{}) (Page, error) {
+	page := Page{Limit: query.Limit}
+
+	if query.IncludeTotal {
+		total, err := count()
+		if err != nil {
+			return page, err
+		}
+		page.Total = &total
+	}
+
+	// Walk backwards from a Before cursor and restore the order afterwards
+	sort := query.Sort
+	backward := query.Cursor != nil && query.Cursor.Before
+	if backward {
+		sort = sort.Reverse()
+	}
+	var after bson.M
+	if query.Cursor != nil {
+		after = sort.After(*query.Cursor)
+	}
+
+	// Fetch one extra document to learn whether there is another page
+	docs, err := find(sort, after)
+	if err != nil {
+		return page, err
+	}
+
+	more := len(docs) > query.Limit
+	if more {
+		docs = docs[:query.Limit]
+	}
+	if backward {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+
+	// Coming from a cursor means there is a page on the side we came from
+	hasNext, hasPrev := more, query.Cursor != nil
+	if backward {
+		hasNext, hasPrev = true, more
+	}
+
+	if len(docs) > 0 {
+		if hasNext {
+			page.NextCursor, err = cursorAt(docs[len(docs)-1], query.Sort, false)
+			if err != nil {
+				return page, err
+			}
+		}
+		if hasPrev {
+			page.PrevCursor, err = cursorAt(docs[0], query.Sort, true)
+			if err != nil {
+				return page, err
+			}
+		}
+	}
+	page.HasMore = page.NextCursor != ""
+
+	return page, decodeAll(docs, results)
+}
+
+func cursorAt(doc bson.Raw, sort Sort, before bool) (string, error) {
+	c := Cursor{Sort: sort.String(), Before: before}
+	for _, field := range sort {
+		value, err := doc.LookupErr(strings.Split(field.Field, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bson.TypeNull}
+		}
+		c.Values = append(c.Values, value)
+	}
+
+	id, ok := doc.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", fmt.Errorf("document has no ObjectID _id")
+	}
+	c.ID = id
+	return c.Encode()
+}
+
+func decodeAll(docs []bson.Raw, results interface{}) error {
+	slice := reflect.ValueOf(results).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(docs)))
+	for _, doc := range docs {
+		elem := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(doc, elem.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package pagination
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Response is the envelope returned by paginated list endpoints.
+type Response struct {
+	Data       interface{} `json:"data"`
+	Pagination Page        `json:"pagination"`
+	Links      Links       `json:"links"`
+}
+
+type Links struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// NewResponse wraps a page of data, linking to the neighbouring pages with
+// the same query parameters as the request.
+func NewResponse(r *http.Request, data interface{}, page Page) Response {
+	return Response{
+		Data:       data,
+		Pagination: page,
+		Links: Links{
+			Next: pageLink(r.URL, page.NextCursor),
+			Prev: pageLink(r.URL, page.PrevCursor),
+		},
+	}
+}
+
+func pageLink(u *url.URL, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	values := u.Query()
+	values.Set("cursor", cursor)
+	link := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return link.String()
+}
@@ -0,0 +1,121 @@
+package pagination
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Sort is an ordered list of sort fields, most significant first.
+type Sort []SortField
+
+// ParseSort parses a sort parameter such as "price,-name", accepting only
+// the allowed fields. A leading "-" sorts that field in descending order.
+func ParseSort(param string, allowed []string, fallback Sort) (Sort, error) {
+	if param == "" {
+		return fallback, nil
+	}
+
+	var sort Sort
+	seen := map[string]bool{}
+	for _, part := range strings.Split(param, ",") {
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !contains(allowed, field.Field) {
+			return nil, fmt.Errorf("invalid sort field %q, must be one of: %s", field.Field, strings.Join(allowed, ", "))
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("duplicate sort field %q", field.Field)
+		}
+		seen[field.Field] = true
+		sort = append(sort, field)
+	}
+	return sort, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the sort in the same form ParseSort accepts.
+func (s Sort) String() string {
+	parts := make([]string, len(s))
+	for i, field := range s {
+		parts[i] = field.Field
+		if field.Desc {
+			parts[i] = "-" + field.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Keys returns the sort document, using _id as a tie-breaker so that the
+// order is total.
+func (s Sort) Keys() bson.D {
+	keys := bson.D{}
+	for _, field := range s {
+		keys = append(keys, bson.E{Key: field.Field, Value: field.direction()})
+	}
+	return append(keys, bson.E{Key: "_id", Value: s.idField().direction()})
+}
+
+// Reverse returns the opposite sort order on the same fields.
+func (s Sort) Reverse() Sort {
+	reversed := make(Sort, len(s))
+	for i, field := range s {
+		reversed[i] = SortField{Field: field.Field, Desc: !field.Desc}
+	}
+	return reversed
+}
+
+// After returns a filter matching the documents that follow the cursor in
+// this sort order: those greater on the first field, or equal on it and
+// greater on the next, and so on down to _id.
+func (s Sort) After(c Cursor) bson.M {
+	fields := append(append(Sort{}, s...), s.idField())
+	values := append(append([]bson.RawValue{}, c.Values...), bson.RawValue{})
+
+	var or []bson.M
+	for i, field := range fields {
+		condition := bson.M{}
+		for j := 0; j < i; j++ {
+			condition[fields[j].Field] = values[j]
+		}
+		if field.Field == "_id" {
+			condition["_id"] = bson.M{field.operator(): c.ID}
+		} else {
+			condition[field.Field] = bson.M{field.operator(): values[i]}
+		}
+		or = append(or, condition)
+	}
+	return bson.M{"$or": or}
+}
+
+// idField is the _id tie-breaker, sorted in the direction of the last field.
+func (s Sort) idField() SortField {
+	return SortField{Field: "_id", Desc: len(s) > 0 && s[len(s)-1].Desc}
+}
+
+func (f SortField) direction() int {
+	if f.Desc {
+		return -1
+	}
+	return 1
+}
+
+func (f SortField) operator() string {
+	if f.Desc {
+		return "$lt"
+	}
+	return "$gt"
+}
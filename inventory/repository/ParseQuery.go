@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTimeParam reads an RFC 3339 timestamp or a YYYY-MM-DD date from the
+// query. A date-only upper bound is moved to the end of that day so that
+// ranges like created_to=2026-01-31 include the whole day.
+func ParseTimeParam(values url.Values, key string, upper bool) (*time.Time, error) {
+	value := values.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: must be RFC 3339 or YYYY-MM-DD", key)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// ParseFloatParam reads an optional number from the query.
+func ParseFloatParam(values url.Values, key string) (*float64, error) {
+	value := values.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return &f, nil
+}
+
+// ParseIntParam reads an optional integer from the query.
+func ParseIntParam(values url.Values, key string) (*int, error) {
+	value := values.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return &i, nil
+}
+
+// ParseListParam reads a comma-separated or repeated query parameter.
+func ParseListParam(values url.Values, key string) []string {
+	var list []string
+	for _, value := range values[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// RangeFilter builds an inclusive range condition, or nil if neither bound
+// is set.
+func RangeFilter[T any](min, max *T) bson.M {
+	if min == nil && max == nil {
+		return nil
+	}
+	condition := bson.M{}
+	if min != nil {
+		condition["$gte"] = *min
+	}
+	if max != nil {
+		condition["$lte"] = *max
+	}
+	return condition
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	HighlightOpen  = "<mark>"
+	HighlightClose = "</mark>"
+)
+
+// Highlight HTML-escapes text and wraps every word that starts with the stem
+// of one of the terms in <mark> tags. It returns "" if nothing matched.
+func Highlight(text string, terms []string) string {
+	stems := make([]string, len(terms))
+	for i, term := range terms {
+		stems[i] = stem(term)
+	}
+
+	var b strings.Builder
+	matched := false
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if matchesAny(strings.ToLower(word), stems) {
+			matched = true
+			b.WriteString(HighlightOpen + html.EscapeString(word) + HighlightClose)
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		i = j
+	}
+
+	if !matched {
+		return ""
+	}
+	return b.String()
+}
+
+func matchesAny(word string, stems []string) bool {
+	for _, s := range stems {
+		if s != "" && strings.HasPrefix(word, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
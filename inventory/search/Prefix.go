@@ -0,0 +1,86 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaxPrefixDistance is the number of typos tolerated in an autocomplete
+// prefix of the given length.
+func MaxPrefixDistance(length int) int {
+	switch {
+	case length <= 2:
+		return 0
+	case length <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// CandidatePattern returns a regular expression matching text with a word
+// that may start like prefix within the typos MaxPrefixDistance allows for
+// it. Besides words starting with the first letter of prefix it matches
+// those where the first letter was left out, swapped with the second,
+// replaced or preceded by another letter, so candidates can be narrowed
+// down before PrefixDistance ranks them.
+func CandidatePattern(prefix string) string {
+	runes := []rune(strings.ToLower(prefix))
+	if len(runes) == 0 {
+		return ""
+	}
+
+	first := regexp.QuoteMeta(string(runes[0]))
+	starts := []string{first}
+	if MaxPrefixDistance(len(runes)) > 0 && len(runes) > 1 {
+		second := regexp.QuoteMeta(string(runes[1]))
+		starts = append(starts, second, "."+second, "."+first)
+	}
+	return `(^|\W)(` + strings.Join(starts, "|") + `)`
+}
+
+// PrefixDistance returns the smallest edit distance between prefix and the
+// beginning of text or of any word in it, counting insertions, deletions,
+// substitutions and transpositions of adjacent letters.
+func PrefixDistance(prefix, text string) int {
+	prefix = strings.ToLower(prefix)
+	best := prefixDistance([]rune(prefix), []rune(strings.ToLower(text)))
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isWordRune(r) }) {
+		best = min(best, prefixDistance([]rune(prefix), []rune(word)))
+	}
+	return best
+}
+
+// prefixDistance computes the optimal string alignment distance between p
+// and the closest prefix of w.
+func prefixDistance(p, w []rune) int {
+	rows := make([][]int, len(p)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(w)+1)
+		rows[i][0] = i
+	}
+	for j := 0; j <= len(w); j++ {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(p); i++ {
+		for j := 1; j <= len(w); j++ {
+			cost := 1
+			if p[i-1] == w[j-1] {
+				cost = 0
+			}
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && p[i-1] == w[j-2] && p[i-2] == w[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+
+	// Any prefix of w may end the match, so take the best in the last row
+	best := rows[len(p)][0]
+	for _, d := range rows[len(p)] {
+		best = min(best, d)
+	}
+	return best
+}
@@ -0,0 +1,35 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Terms splits a search query into lower-case words, dropping the negated
+// terms and punctuation understood by Mongo's $text operator.
+func Terms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		word := strings.ToLower(strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		if word != "" {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// stem strips common English suffixes so that "laptops" also highlights
+// "laptop", roughly following the stemming done by the text index.
+func stem(term string) string {
+	for _, suffix := range []string{"ing", "es", "ed", "s"} {
+		if len(term)-len(suffix) >= 3 && strings.HasSuffix(term, suffix) {
+			return strings.TrimSuffix(term, suffix)
+		}
+	}
+	return term
+}
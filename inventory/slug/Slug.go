@@ -0,0 +1,54 @@
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxLength bounds generated slugs so URLs stay readable.
+const MaxLength = 80
+
+// Make turns text into a URL slug: lower-case letters and digits separated
+// by single hyphens, e.g. "High-Performance Laptop 15\"" becomes
+// "high-performance-laptop-15".
+func Make(text string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+
+	s := b.String()
+	if len(s) > MaxLength {
+		s = strings.TrimRight(truncate(s, MaxLength), "-")
+	}
+	return s
+}
+
+// Valid reports whether s is already in the form Make produces.
+func Valid(s string) bool {
+	return s != "" && Make(s) == s
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	end := 0
+	for i := range s {
+		if i > n {
+			break
+		}
+		end = i
+	}
+	if len(s) <= n {
+		return s
+	}
+	return s[:end]
+}
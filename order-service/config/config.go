@@ -1 +1,65 @@
 package config
+
+import (
+	"encoding/json"
+	inventoryconfig "inventory/config"
+	"inventory/order-service/models"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	ShippingRates   []models.ShippingRate
+	PaymentProvider string
+
+	OrderExpiryAge      time.Duration
+	OrderExpiryInterval time.Duration
+)
+
+// defaultShippingRates is used when SHIPPING_RATES_FILE is not set.
+var defaultShippingRates = []models.ShippingRate{
+	{Zone: "domestic", Service: "standard", MinWeight: 0, MaxWeight: 1, Price: 4.99},
+	{Zone: "domestic", Service: "standard", MinWeight: 1, MaxWeight: 5, Price: 8.99},
+	{Zone: "domestic", Service: "standard", MinWeight: 5, MaxWeight: 0, Price: 14.99},
+	{Zone: "domestic", Service: "express", MinWeight: 0, MaxWeight: 1, Price: 9.99},
+	{Zone: "domestic", Service: "express", MinWeight: 1, MaxWeight: 5, Price: 16.99},
+	{Zone: "domestic", Service: "express", MinWeight: 5, MaxWeight: 0, Price: 29.99},
+	{Zone: "international", Service: "standard", MinWeight: 0, MaxWeight: 1, Price: 14.99},
+	{Zone: "international", Service: "standard", MinWeight: 1, MaxWeight: 5, Price: 29.99},
+	{Zone: "international", Service: "standard", MinWeight: 5, MaxWeight: 0, Price: 59.99},
+}
+
+func init() {
+	ShippingRates = loadShippingRates(getEnv("SHIPPING_RATES_FILE", ""))
+	PaymentProvider = getEnv("PAYMENT_PROVIDER", "fake")
+	OrderExpiryAge = inventoryconfig.GetDuration("ORDER_EXPIRY_AGE", 24*time.Hour)
+	OrderExpiryInterval = inventoryconfig.GetDuration("ORDER_EXPIRY_INTERVAL", 5*time.Minute)
+}
+
+// loadShippingRates reads the rate table from a JSON file holding an array
+// of rates, falling back to the defaults when no file is configured.
+func loadShippingRates(path string) []models.ShippingRate {
+	if path == "" {
+		return defaultShippingRates
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read shipping rates file: %v", err)
+	}
+
+	var rates []models.ShippingRate
+	if err := json.Unmarshal(data, &rates); err != nil {
+		log.Fatalf("Failed to parse shipping rates file: %v", err)
+	}
+	return rates
+}
+
+func getEnv(key, fallback string) string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	return value
+}
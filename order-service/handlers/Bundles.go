@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	handlers2 "inventory/handlers"
+	"inventory/models"
+	"time"
+)
+
+// reserveBundleComponents takes the stock for quantity bundles from the
+// bundle's components and returns what was taken, for the order item.
+func reserveBundleComponents(ctx context.Context, bundle models.Product, quantity int) ([]OrderItemComponent, error) {
+	var components []OrderItemComponent
+	for _, component := range bundle.Components {
+		needed := component.Quantity * quantity
+
+		// Find the component, deleted products cannot be ordered
+		var product models.Product
+		err := handlers2.productsCollection.FindOne(
+			ctx,
+			bson.M{"_id": component.ProductID, "deleted_at": bson.M{"$exists": false}},
+		).Decode(&product)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, fmt.Errorf("component %s of bundle with ID %s not found", component.ProductID.Hex(), bundle.ID.Hex())
+			}
+			return nil, err
+		}
+
+		stockLevel := product.StockLevel
+		stockFilter := bson.M{"_id": product.ID}
+		stockInc := bson.M{"version": 1, "stock_level": -needed}
+		orderComponent := OrderItemComponent{ProductID: product.ID, SKU: product.SKU, Quantity: needed}
+
+		if component.VariantID != nil {
+			variant := product.Variant(*component.VariantID)
+			if variant == nil {
+				return nil, fmt.Errorf("variant %s of bundle with ID %s not found", component.VariantID.Hex(), bundle.ID.Hex())
+			}
+			stockLevel = variant.StockLevel
+			stockFilter["variants._id"] = variant.ID
+			stockInc["variants.$.stock_level"] = -needed
+			orderComponent.VariantID = &variant.ID
+			orderComponent.SKU = variant.SKU
+		}
+
+		// Check stock
+		if stockLevel < needed {
+			return nil, fmt.Errorf("not enough stock for bundle with ID %s", bundle.ID.Hex())
+		}
+
+		// Update stock level
+		_, err = handlers2.productsCollection.UpdateOne(
+			ctx,
+			stockFilter,
+			bson.M{"$inc": stockInc, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, orderComponent)
+	}
+	return components, nil
+}
+
+// componentsShippingWeight sums the billable weight of bundle components,
+// for bundles that have no weight of their own.
+func componentsShippingWeight(ctx context.Context, components []OrderItemComponent) (float64, error) {
+	var weight float64
+	for _, component := range components {
+		var product models.Product
+		err := handlers2.productsCollection.FindOne(ctx, bson.M{"_id": component.ProductID}).Decode(&product)
+		if err != nil {
+			return 0, err
+		}
+		weight += product.ShippingWeight() * float64(component.Quantity)
+	}
+	return weight, nil
+}
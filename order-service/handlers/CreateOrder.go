@@ -12,6 +12,7 @@ import (
 	handlers2 "inventory/handlers"
 	"inventory/models"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -34,6 +35,31 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A shipping method needs a zone and one of the services offered there
+	if req.ShippingZone != "" || req.ShippingService != "" {
+		if req.ShippingZone == "" {
+			handlers2.RespondWithError(w, http.StatusBadRequest, "Shipping zone is required when a shipping service is given")
+			return
+		}
+		services := shippingServices(req.ShippingZone)
+		if len(services) == 0 {
+			handlers2.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("No shipping rates available for zone %s", req.ShippingZone))
+			return
+		}
+		if !containsString(services, req.ShippingService) {
+			handlers2.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid shipping service, must be one of: %s", strings.Join(services, ", ")))
+			return
+		}
+	}
+
+	// Reserve a human-readable order number
+	tenant := tenantID(r)
+	number, err := nextOrderNumber(ctx, tenant, time.Now())
+	if err != nil {
+		handlers2.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Start a session for transaction
 	session, err := handlers2.Client.StartSession()
 	if err != nil {
@@ -52,6 +78,7 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 		// Calculate total and check inventory
 		var total float64
+		var weight float64
 		var orderItems []OrderItem
 
 		for _, item := range req.Items {
@@ -59,57 +86,153 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 				return fmt.Errorf("item quantity must be greater than zero")
 			}
 
-			// Convert string product ID to ObjectID
-			productID, err := primitive.ObjectIDFromHex(item.ProductID)
-			if err != nil {
-				return fmt.Errorf("invalid product ID: %s", item.ProductID)
+			// Items name a product by ID, or by its own or a variant's SKU
+			productFilter := bson.M{"$or": []bson.M{{"sku": item.SKU}, {"variants.sku": item.SKU}}}
+			if item.ProductID != "" || item.SKU == "" {
+				// Convert string product ID to ObjectID
+				productID, err := primitive.ObjectIDFromHex(item.ProductID)
+				if err != nil {
+					return fmt.Errorf("invalid product ID: %s", item.ProductID)
+				}
+				productFilter = bson.M{"_id": productID}
 			}
 
-			// Find product
+			// Find product, deleted products cannot be ordered
+			productFilter["deleted_at"] = bson.M{"$exists": false}
 			var product models.Product
-			err = handlers2.productsCollection.FindOne(sessionContext, bson.M{"_id": productID}).Decode(&product)
+			err := handlers2.productsCollection.FindOne(sessionContext, productFilter).Decode(&product)
 			if err != nil {
 				if err == mongo.ErrNoDocuments {
+					if item.ProductID == "" {
+						return fmt.Errorf("product with SKU %s not found", item.SKU)
+					}
 					return fmt.Errorf("product with ID %s not found", item.ProductID)
 				}
 				return err
 			}
+			productID := product.ID
+			if item.ProductID == "" {
+				item.ProductID = productID.Hex()
+			}
+
+			// Bundles take their stock from the components
+			if product.Type == models.ProductTypeBundle {
+				if item.VariantID != "" {
+					return fmt.Errorf("bundle with ID %s has no variants", item.ProductID)
+				}
+				components, err := reserveBundleComponents(sessionContext, product, item.Quantity)
+				if err != nil {
+					return err
+				}
+
+				total += product.Price * float64(item.Quantity)
+
+				// Bundles without a weight of their own ship at their components' weight
+				if bundleWeight := product.ShippingWeight(); bundleWeight > 0 {
+					weight += bundleWeight * float64(item.Quantity)
+				} else {
+					componentWeight, err := componentsShippingWeight(sessionContext, components)
+					if err != nil {
+						return err
+					}
+					weight += componentWeight
+				}
+				orderItems = append(orderItems, OrderItem{
+					ProductID:  productID,
+					SKU:        product.SKU,
+					Quantity:   item.Quantity,
+					Price:      product.Price,
+					Components: components,
+				})
+				continue
+			}
+
+			// A variant SKU selects that variant
+			if item.VariantID == "" && item.SKU != "" {
+				for _, variant := range product.Variants {
+					if variant.SKU == item.SKU {
+						item.VariantID = variant.ID.Hex()
+					}
+				}
+			}
+
+			// Products with variants are ordered by variant
+			price := product.Price
+			stockLevel := product.StockLevel
+			stockFilter := bson.M{"_id": productID}
+			stockInc := bson.M{"version": 1, "stock_level": -item.Quantity}
+			orderItem := OrderItem{ProductID: productID, Quantity: item.Quantity}
+
+			if len(product.Variants) > 0 || item.VariantID != "" {
+				variantID, err := primitive.ObjectIDFromHex(item.VariantID)
+				if err != nil {
+					return fmt.Errorf("product with ID %s requires a valid variant ID", item.ProductID)
+				}
+				variant := product.Variant(variantID)
+				if variant == nil {
+					return fmt.Errorf("variant with ID %s not found for product with ID %s", item.VariantID, item.ProductID)
+				}
+
+				price = product.VariantPrice(*variant)
+				stockLevel = variant.StockLevel
+				stockFilter["variants._id"] = variantID
+				stockInc["variants.$.stock_level"] = -item.Quantity
+				orderItem.VariantID = &variant.ID
+				orderItem.SKU = variant.SKU
+			}
 
 			// Check stock
-			if product.StockLevel < item.Quantity {
+			if stockLevel < item.Quantity {
 				return fmt.Errorf("not enough stock for product with ID %s", item.ProductID)
 			}
 
 			// Calculate item total
-			itemTotal := product.Price * float64(item.Quantity)
+			itemTotal := price * float64(item.Quantity)
 			total += itemTotal
+			weight += product.ShippingWeight() * float64(item.Quantity)
 
 			// Add to order items
-			orderItems = append(orderItems, OrderItem{
-				ProductID: productID,
-				Quantity:  item.Quantity,
-				Price:     product.Price,
-			})
+			orderItem.Price = price
+			orderItems = append(orderItems, orderItem)
 
 			// Update stock level
 			_, err = handlers2.productsCollection.UpdateOne(
 				sessionContext,
-				bson.M{"_id": productID},
-				bson.M{"$inc": bson.M{"stock_level": -item.Quantity}, "$set": bson.M{"updated_at": time.Now()}},
+				stockFilter,
+				bson.M{"$inc": stockInc, "$set": bson.M{"updated_at": time.Now()}},
 			)
 			if err != nil {
 				return err
 			}
 		}
 
+		// Add the chosen shipping method to the total
+		var shipping *Shipping
+		if req.ShippingZone != "" {
+			cost, err := shippingCost(req.ShippingZone, req.ShippingService, weight)
+			if err != nil {
+				return err
+			}
+			shipping = &Shipping{
+				Zone:    req.ShippingZone,
+				Service: req.ShippingService,
+				Weight:  weight,
+				Cost:    cost,
+			}
+			total += cost
+		}
+
 		// Create order
 		now := time.Now()
 		order = Order{
 			ID:        primitive.NewObjectID(),
+			Number:    number,
+			TenantID:  tenant,
 			UserID:    req.UserID,
 			Status:    "pending",
 			Total:     total,
 			Items:     orderItems,
+			Shipping:  shipping,
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
@@ -133,3 +256,12 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 	handlers2.RespondWithJSON(w, http.StatusCreated, order)
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -6,21 +6,26 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"inventory/handlers"
+	"inventory/pagination"
+	"inventory/repository"
 	"net/http"
 	"strconv"
 )
 
+var orderSortFields = []string{"created_at", "updated_at", "total", "status"}
+
 func GetOrders(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
+	values := r.URL.Query()
 
 	// Get query parameters for filtering
-	userIDStr := r.URL.Query().Get("user_id")
-	status := r.URL.Query().Get("status")
+	userIDStr := values.Get("user_id")
+	status := values.Get("status")
+	productIDStr := values.Get("product_id")
 
-	// Build the filter
-	filter := bson.M{}
+	// Build the filter, tenants only see their own orders
+	filter := bson.M{"tenant_id": tenantFilter(r)}
 
 	if userIDStr != "" {
 		userID, err := strconv.Atoi(userIDStr)
@@ -33,22 +38,66 @@ func GetOrders(w http.ResponseWriter, r *http.Request) {
 		filter["status"] = status
 	}
 
-	// Query orders
-	cursor, err := handlers.ordersCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if productIDStr != "" {
+		productID, err := primitive.ObjectIDFromHex(productIDStr)
+		if err != nil {
+			handlers.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+			return
+		}
+		filter["items.product_id"] = productID
+	}
+
+	// Date range on creation time
+	createdFrom, err := repository.ParseTimeParam(values, "created_from", false)
 	if err != nil {
-		handlers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		handlers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	createdTo, err := repository.ParseTimeParam(values, "created_to", true)
+	if err != nil {
+		handlers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if createdRange := repository.RangeFilter(createdFrom, createdTo); createdRange != nil {
+		filter["created_at"] = createdRange
+	}
+
+	// Range on order total
+	minTotal, err := repository.ParseFloatParam(values, "min_total")
+	if err != nil {
+		handlers.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer cursor.Close(ctx)
+	maxTotal, err := repository.ParseFloatParam(values, "max_total")
+	if err != nil {
+		handlers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if totalRange := repository.RangeFilter(minTotal, maxTotal); totalRange != nil {
+		filter["total"] = totalRange
+	}
 
-	// Decode results
+	// Sorting and pagination
+	sort, err := pagination.ParseSort(values.Get("sort"), orderSortFields, pagination.Sort{{Field: "created_at", Desc: true}})
+	if err != nil {
+		handlers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, err := pagination.ParseQuery(values, sort)
+	if err != nil {
+		handlers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Query orders
 	var orders []Order
-	if err := cursor.All(ctx, &orders); err != nil {
+	page, err := pagination.Fetch(ctx, handlers.ordersCollection, filter, query, &orders)
+	if err != nil {
 		handlers.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	handlers.RespondWithJSON(w, http.StatusOK, orders)
+	handlers.RespondWithJSON(w, http.StatusOK, pagination.NewResponse(r, orders, page))
 }
 
 func GetOrder(w http.ResponseWriter, r *http.Request) {
@@ -56,16 +105,16 @@ func GetOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	// Convert string ID to ObjectID
-	id, err := primitive.ObjectIDFromHex(idStr)
-	if err != nil {
-		handlers.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
-		return
+	// Look the order up by ObjectID, or by order number otherwise, within
+	// the request's tenant
+	filter := bson.M{"tenant_id": tenantFilter(r), "number": idStr}
+	if id, err := primitive.ObjectIDFromHex(idStr); err == nil {
+		filter = bson.M{"tenant_id": tenantFilter(r), "_id": id}
 	}
 
-	// Find order by ID
+	// Find order
 	var order Order
-	err = handlers.ordersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	err := handlers.ordersCollection.FindOne(ctx, filter).Decode(&order)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			handlers.RespondWithError(w, http.StatusNotFound, "Order not found")
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	handlers2 "inventory/handlers"
+	"net/http"
+	"time"
+)
+
+const defaultTenantID = "default"
+
+// tenantID returns the tenant a request acts for, taken from the
+// X-Tenant-ID header.
+func tenantID(r *http.Request) string {
+	if tenant := r.Header.Get("X-Tenant-ID"); tenant != "" {
+		return tenant
+	}
+	return defaultTenantID
+}
+
+// tenantFilter matches the orders of the request's tenant. Orders placed
+// before tenants existed have no tenant and belong to the default one.
+func tenantFilter(r *http.Request) interface{} {
+	tenant := tenantID(r)
+	if tenant == defaultTenantID {
+		return bson.M{"$in": []interface{}{tenant, nil}}
+	}
+	return tenant
+}
+
+// nextOrderNumber atomically reserves the next order number for a tenant,
+// e.g. ORD-2026-000123. Sequences restart every year. The counter is
+// incremented outside the order transaction, so an order that fails to
+// commit leaves a gap in the sequence rather than blocking other orders.
+func nextOrderNumber(ctx context.Context, tenant string, now time.Time) (string, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := handlers2.countersCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": fmt.Sprintf("order:%s:%d", tenant, now.Year())},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ORD-%d-%06d", now.Year(), counter.Seq), nil
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	handlers2 "inventory/handlers"
+	"inventory/order-service/payments"
+	"log"
+	"net/http"
+	"time"
+)
+
+var paymentProvider = payments.Default
+
+// AuthorizePayment authorizes the order total with the payment provider and
+// moves a pending order to processing once the authorization succeeds.
+func AuthorizePayment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	order, ok := findPaymentOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var req handlers2.PaymentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		handlers2.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if order.Status != "pending" {
+		handlers2.RespondWithError(w, http.StatusConflict, "Only pending orders can be paid")
+		return
+	}
+	if order.ActivePayment() != nil {
+		handlers2.RespondWithError(w, http.StatusConflict, "Order already has an active payment")
+		return
+	}
+
+	now := time.Now()
+	payment := Payment{
+		ID:        primitive.NewObjectID(),
+		Provider:  paymentProvider.Name(),
+		Amount:    order.Total,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	authorizationID, err := paymentProvider.Authorize(ctx, order.Total, req.Source)
+	if err != nil {
+		// Record the failed attempt on the order before reporting it
+		payment.Status = "declined"
+		payment.Error = err.Error()
+		_, updateErr := handlers2.ordersCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": order.ID},
+			bson.M{"$push": bson.M{"payments": payment}, "$set": bson.M{"updated_at": now}},
+		)
+		if updateErr != nil {
+			handlers2.RespondWithError(w, http.StatusInternalServerError, updateErr.Error())
+			return
+		}
+		if errors.Is(err, payments.ErrDeclined) {
+			handlers2.RespondWithError(w, http.StatusPaymentRequired, err.Error())
+			return
+		}
+		handlers2.RespondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	payment.Status = "authorized"
+	payment.AuthorizationID = authorizationID
+
+	// Only move the order forward if nobody changed its status meanwhile
+	result, err := handlers2.ordersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": order.ID, "status": "pending"},
+		bson.M{"$push": bson.M{"payments": payment}, "$set": bson.M{"status": "processing", "updated_at": now}},
+	)
+	if err == nil && result.MatchedCount == 0 {
+		err = errors.New("order is no longer pending")
+	}
+	if err != nil {
+		if voidErr := paymentProvider.Void(ctx, authorizationID); voidErr != nil {
+			log.Printf("Failed to void authorization %s: %v", authorizationID, voidErr)
+		}
+		handlers2.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	respondWithOrder(w, order.ID)
+}
+
+func CapturePayment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	order, ok := findPaymentOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var req handlers2.PaymentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			handlers2.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	payment := order.ActivePayment()
+	if payment == nil || payment.Status != "authorized" {
+		handlers2.RespondWithError(w, http.StatusConflict, "Order has no authorized payment to capture")
+		return
+	}
+
+	amount := payment.Amount
+	if req.Amount > 0 {
+		amount = req.Amount
+	}
+
+	if err := paymentProvider.Capture(ctx, payment.AuthorizationID, amount); err != nil {
+		handlers2.RespondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if !updatePayment(w, order.ID, payment.ID, bson.M{"status": "captured", "captured_amount": amount}) {
+		return
+	}
+	respondWithOrder(w, order.ID)
+}
+
+func VoidPayment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	order, ok := findPaymentOrder(w, r)
+	if !ok {
+		return
+	}
+
+	payment := order.ActivePayment()
+	if payment == nil || payment.Status != "authorized" {
+		handlers2.RespondWithError(w, http.StatusConflict, "Order has no authorized payment to void")
+		return
+	}
+
+	if err := paymentProvider.Void(ctx, payment.AuthorizationID); err != nil {
+		handlers2.RespondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if !updatePayment(w, order.ID, payment.ID, bson.M{"status": "voided"}) {
+		return
+	}
+	respondWithOrder(w, order.ID)
+}
+
+func RefundPayment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	order, ok := findPaymentOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var req handlers2.PaymentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			handlers2.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	payment := order.ActivePayment()
+	if payment == nil || payment.Status == "authorized" {
+		handlers2.RespondWithError(w, http.StatusConflict, "Order has no captured payment to refund")
+		return
+	}
+
+	// Refund whatever is left by default
+	amount := payment.CapturedAmount - payment.RefundedAmount
+	if req.Amount > 0 {
+		amount = req.Amount
+	}
+
+	if err := paymentProvider.Refund(ctx, payment.AuthorizationID, amount); err != nil {
+		handlers2.RespondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	refunded := payment.RefundedAmount + amount
+	status := "partially_refunded"
+	if refunded >= payment.CapturedAmount {
+		status = "refunded"
+	}
+
+	if !updatePayment(w, order.ID, payment.ID, bson.M{"status": status, "refunded_amount": refunded}) {
+		return
+	}
+	respondWithOrder(w, order.ID)
+}
+
+// findPaymentOrder loads the order named in the URL, writing an error
+// response and returning false if it cannot be found.
+func findPaymentOrder(w http.ResponseWriter, r *http.Request) (Order, bool) {
+	var order Order
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		handlers2.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
+		return order, false
+	}
+
+	err = handlers2.ordersCollection.FindOne(context.Background(), bson.M{"_id": id, "tenant_id": tenantFilter(r)}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			handlers2.RespondWithError(w, http.StatusNotFound, "Order not found")
+			return order, false
+		}
+		handlers2.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return order, false
+	}
+	return order, true
+}
+
+// updatePayment sets fields on one payment record of an order.
+func updatePayment(w http.ResponseWriter, orderID, paymentID primitive.ObjectID, fields bson.M) bool {
+	now := time.Now()
+	set := bson.M{"updated_at": now, "payments.$.updated_at": now}
+	for key, value := range fields {
+		set["payments.$."+key] = value
+	}
+
+	_, err := handlers2.ordersCollection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": orderID, "payments._id": paymentID},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		handlers2.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+func respondWithOrder(w http.ResponseWriter, id primitive.ObjectID) {
+	var order Order
+	err := handlers2.ordersCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&order)
+	if err != nil {
+		handlers2.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	handlers2.RespondWithJSON(w, http.StatusOK, order)
+}
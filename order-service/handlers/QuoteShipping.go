@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	handlers2 "inventory/handlers"
+	"inventory/models"
+	"inventory/order-service/config"
+	"net/http"
+	"sort"
+)
+
+type ShippingQuote struct {
+	Zone    string  `json:"zone"`
+	Service string  `json:"service"`
+	Weight  float64 `json:"weight"`
+	Cost    float64 `json:"cost"`
+}
+
+func QuoteShipping(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	var req handlers2.ShippingQuoteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		handlers2.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate request
+	if req.Zone == "" {
+		handlers2.RespondWithError(w, http.StatusBadRequest, "Shipping zone is required")
+		return
+	}
+	if len(req.Items) == 0 {
+		handlers2.RespondWithError(w, http.StatusBadRequest, "Quote must contain at least one item")
+		return
+	}
+
+	// Sum the billable weight of the prospective order
+	var weight float64
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			handlers2.RespondWithError(w, http.StatusBadRequest, "Item quantity must be greater than zero")
+			return
+		}
+
+		productID, err := primitive.ObjectIDFromHex(item.ProductID)
+		if err != nil {
+			handlers2.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid product ID: %s", item.ProductID))
+			return
+		}
+
+		var product models.Product
+		err = handlers2.productsCollection.FindOne(ctx, bson.M{"_id": productID, "deleted_at": bson.M{"$exists": false}}).Decode(&product)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				handlers2.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Product with ID %s not found", item.ProductID))
+				return
+			}
+			handlers2.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Bundles without a weight of their own ship at their components' weight
+		if product.Type == models.ProductTypeBundle && product.ShippingWeight() == 0 {
+			var components []OrderItemComponent
+			for _, component := range product.Components {
+				components = append(components, OrderItemComponent{ProductID: component.ProductID, Quantity: component.Quantity * item.Quantity})
+			}
+			componentWeight, err := componentsShippingWeight(ctx, components)
+			if err != nil {
+				handlers2.RespondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			weight += componentWeight
+			continue
+		}
+
+		weight += product.ShippingWeight() * float64(item.Quantity)
+	}
+
+	// Quote a single service if one was chosen, otherwise every service in the zone
+	services := []string{req.Service}
+	if req.Service == "" {
+		services = shippingServices(req.Zone)
+	}
+
+	var quotes []ShippingQuote
+	for _, service := range services {
+		cost, err := shippingCost(req.Zone, service, weight)
+		if err != nil {
+			if req.Service != "" {
+				handlers2.RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			continue
+		}
+		quotes = append(quotes, ShippingQuote{Zone: req.Zone, Service: service, Weight: weight, Cost: cost})
+	}
+
+	if len(quotes) == 0 {
+		handlers2.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("No shipping rates available for zone %s", req.Zone))
+		return
+	}
+
+	handlers2.RespondWithJSON(w, http.StatusOK, quotes)
+}
+
+// shippingCost looks up the configured rate for a weight in a zone and service.
+func shippingCost(zone, service string, weight float64) (float64, error) {
+	for _, rate := range config.ShippingRates {
+		if rate.Matches(zone, service, weight) {
+			return rate.Price, nil
+		}
+	}
+	return 0, fmt.Errorf("no %s shipping rate for zone %s at %.2f kg", service, zone, weight)
+}
+
+// shippingServices lists the carrier services configured for a zone.
+func shippingServices(zone string) []string {
+	seen := map[string]bool{}
+	var services []string
+	for _, rate := range config.ShippingRates {
+		if rate.Zone == zone && !seen[rate.Service] {
+			seen[rate.Service] = true
+			services = append(services, rate.Service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+	inventoryconfig "inventory/config"
+	"inventory/order-service/config"
+	"inventory/order-service/repository"
+	"time"
+)
+
+var orderExpiry = inventoryconfig.NewJob(
+	"order_expiry",
+	"orders_expired_total",
+	config.OrderExpiryInterval,
+	expireOrders,
+	"Expired %d pending orders",
+	"Failed to expire pending orders",
+)
+
+// RunOrderExpiry cancels unpaid pending orders older than
+// config.OrderExpiryAge every config.OrderExpiryInterval until ctx is done.
+func RunOrderExpiry(ctx context.Context) {
+	orderExpiry.Run(ctx)
+}
+
+func expireOrders(ctx context.Context, now time.Time) (int, error) {
+	return repository.ExpirePendingOrders(ctx, now.Add(-config.OrderExpiryAge))
+}
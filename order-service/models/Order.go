@@ -7,10 +7,14 @@ import (
 
 type Order struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Number    string             `json:"number" bson:"number,omitempty"`
+	TenantID  string             `json:"tenant_id" bson:"tenant_id,omitempty"`
 	UserID    int                `json:"user_id" bson:"user_id"`
 	Status    string             `json:"status" bson:"status"`
 	Total     float64            `json:"total" bson:"total"`
 	Items     []OrderItem        `json:"items" bson:"items"`
+	Shipping  *Shipping          `json:"shipping,omitempty" bson:"shipping,omitempty"`
+	Payments  []Payment          `json:"payments,omitempty" bson:"payments,omitempty"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
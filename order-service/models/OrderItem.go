@@ -2,8 +2,13 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// OrderItem is one line of an order. For a bundle, ProductID names the
+// bundle and Components the products whose stock it took.
 type OrderItem struct {
-	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
-	Quantity  int                `json:"quantity" bson:"quantity"`
-	Price     float64            `json:"price" bson:"price"`
+	ProductID  primitive.ObjectID   `json:"product_id" bson:"product_id"`
+	VariantID  *primitive.ObjectID  `json:"variant_id,omitempty" bson:"variant_id,omitempty"`
+	SKU        string               `json:"sku,omitempty" bson:"sku,omitempty"`
+	Quantity   int                  `json:"quantity" bson:"quantity"`
+	Price      float64              `json:"price" bson:"price"`
+	Components []OrderItemComponent `json:"components,omitempty" bson:"components,omitempty"`
 }
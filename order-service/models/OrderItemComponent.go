@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// OrderItemComponent is a product taken from stock for a bundle on an order
+// item. Quantity is the total for the item, not per bundle.
+type OrderItemComponent struct {
+	ProductID primitive.ObjectID  `json:"product_id" bson:"product_id"`
+	VariantID *primitive.ObjectID `json:"variant_id,omitempty" bson:"variant_id,omitempty"`
+	SKU       string              `json:"sku,omitempty" bson:"sku,omitempty"`
+	Quantity  int                 `json:"quantity" bson:"quantity"`
+}
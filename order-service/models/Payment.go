@@ -0,0 +1,31 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Payment struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	Provider        string             `json:"provider" bson:"provider"`
+	AuthorizationID string             `json:"authorization_id,omitempty" bson:"authorization_id,omitempty"`
+	Status          string             `json:"status" bson:"status"`
+	Amount          float64            `json:"amount" bson:"amount"`
+	CapturedAmount  float64            `json:"captured_amount" bson:"captured_amount"`
+	RefundedAmount  float64            `json:"refunded_amount" bson:"refunded_amount"`
+	Error           string             `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ActivePayment returns the most recent payment that still holds or has
+// taken funds, or nil if there is none.
+func (o Order) ActivePayment() *Payment {
+	for i := len(o.Payments) - 1; i >= 0; i-- {
+		switch o.Payments[i].Status {
+		case "authorized", "captured", "partially_refunded":
+			return &o.Payments[i]
+		}
+	}
+	return nil
+}
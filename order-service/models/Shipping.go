@@ -0,0 +1,8 @@
+package models
+
+type Shipping struct {
+	Zone    string  `json:"zone" bson:"zone"`
+	Service string  `json:"service" bson:"service"`
+	Weight  float64 `json:"weight" bson:"weight"`
+	Cost    float64 `json:"cost" bson:"cost"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// ShippingRate prices one weight band of a carrier service within a zone.
+// MinWeight is inclusive and MaxWeight exclusive; a MaxWeight of zero means
+// the band has no upper limit.
+type ShippingRate struct {
+	Zone      string  `json:"zone"`
+	Service   string  `json:"service"`
+	MinWeight float64 `json:"min_weight"`
+	MaxWeight float64 `json:"max_weight"`
+	Price     float64 `json:"price"`
+}
+
+func (r ShippingRate) Matches(zone, service string, weight float64) bool {
+	if r.Zone != zone || r.Service != service {
+		return false
+	}
+	return weight >= r.MinWeight && (r.MaxWeight == 0 || weight < r.MaxWeight)
+}
@@ -0,0 +1,102 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeclinedSource is refused by FakeProvider, so declines can be tried locally.
+const DeclinedSource = "tok_declined"
+
+// FakeProvider is an in-process PaymentProvider for local development. It
+// keeps authorizations in memory and approves every source except
+// DeclinedSource.
+type FakeProvider struct {
+	mu             sync.Mutex
+	authorizations map[string]*fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	amount   float64
+	captured float64
+	refunded float64
+	voided   bool
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{authorizations: map[string]*fakeAuthorization{}}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, amount float64, source string) (string, error) {
+	if amount <= 0 {
+		return "", fmt.Errorf("amount must be greater than zero")
+	}
+	if source == DeclinedSource {
+		return "", ErrDeclined
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := "auth_" + primitive.NewObjectID().Hex()
+	p.authorizations[id] = &fakeAuthorization{amount: amount}
+	return id, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, authorizationID string, amount float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	auth, ok := p.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if auth.voided {
+		return fmt.Errorf("authorization %s has been voided", authorizationID)
+	}
+	if auth.captured > 0 {
+		return fmt.Errorf("authorization %s has already been captured", authorizationID)
+	}
+	if amount <= 0 || amount > auth.amount {
+		return fmt.Errorf("capture amount must be between 0 and %.2f", auth.amount)
+	}
+	auth.captured = amount
+	return nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, authorizationID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	auth, ok := p.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if auth.captured > 0 {
+		return fmt.Errorf("authorization %s has already been captured", authorizationID)
+	}
+	auth.voided = true
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, authorizationID string, amount float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	auth, ok := p.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if amount <= 0 || auth.refunded+amount > auth.captured {
+		return fmt.Errorf("refund amount must be between 0 and %.2f", auth.captured-auth.refunded)
+	}
+	auth.refunded += amount
+	return nil
+}
@@ -0,0 +1,49 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inventory/order-service/config"
+	"log"
+)
+
+var (
+	ErrDeclined             = errors.New("payment declined")
+	ErrUnknownAuthorization = errors.New("unknown authorization")
+)
+
+// PaymentProvider is implemented by every payment gateway the order service
+// can charge through. Amounts are in the order currency.
+type PaymentProvider interface {
+	Name() string
+	// Authorize reserves the amount on the payment source and returns the
+	// provider's authorization ID. It returns ErrDeclined when the source is
+	// refused.
+	Authorize(ctx context.Context, amount float64, source string) (string, error)
+	Capture(ctx context.Context, authorizationID string, amount float64) error
+	Void(ctx context.Context, authorizationID string) error
+	Refund(ctx context.Context, authorizationID string, amount float64) error
+}
+
+// Default is the provider named by PAYMENT_PROVIDER. Every part of the
+// order service shares it, since a provider may keep state of its own.
+var Default PaymentProvider
+
+func init() {
+	var err error
+	Default, err = NewProvider(config.PaymentProvider)
+	if err != nil {
+		log.Fatalf("Failed to create payment provider: %v", err)
+	}
+}
+
+// NewProvider returns the provider configured under name.
+func NewProvider(name string) (PaymentProvider, error) {
+	switch name {
+	case "", "fake":
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider: %s", name)
+	}
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"inventory/handlers"
+	"inventory/order-service/payments"
+	"time"
+)
+
+var (
+	ErrOrderChanged       = errors.New("order status changed concurrently")
+	ErrPaymentNotReleased = errors.New("order cancelled but its payment could not be released")
+)
+
+// CancelOrder restores the stock held by an order and marks it cancelled in
+// a single transaction. The order must still have the status it was read
+// with, otherwise ErrOrderChanged is returned and nothing is changed.
+//
+// Once the order is cancelled an open authorization is voided and a captured
+// payment refunded. If that fails the order stays cancelled and an error
+// wrapping ErrPaymentNotReleased is returned.
+func CancelOrder(ctx context.Context, order Order) error {
+	session, err := handlers.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		// Transaction started
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		// Restore stock for each item, bundles return it to their components
+		for _, item := range order.Items {
+			stock := []OrderItemComponent{{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}}
+			if len(item.Components) > 0 {
+				stock = item.Components
+			}
+
+			for _, held := range stock {
+				stockFilter := bson.M{"_id": held.ProductID}
+				stockInc := bson.M{"version": 1, "stock_level": held.Quantity}
+				if held.VariantID != nil {
+					stockFilter["variants._id"] = *held.VariantID
+					stockInc["variants.$.stock_level"] = held.Quantity
+				}
+
+				_, err := handlers.productsCollection.UpdateOne(
+					sessionContext,
+					stockFilter,
+					bson.M{"$inc": stockInc, "$set": bson.M{"updated_at": time.Now()}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Update order status
+		result, err := handlers.ordersCollection.UpdateOne(
+			sessionContext,
+			bson.M{"_id": order.ID, "status": order.Status},
+			bson.M{"$set": bson.M{"status": "cancelled", "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrOrderChanged
+		}
+
+		// Commit the transaction
+		return session.CommitTransaction(sessionContext)
+	})
+
+	if err != nil {
+		// Transaction failed
+		session.AbortTransaction(ctx)
+		return err
+	}
+
+	if err := releasePayment(ctx, order); err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentNotReleased, err)
+	}
+	return nil
+}
+
+// releasePayment voids the order's open authorization or refunds what was
+// captured and not refunded yet, then records it on the payment.
+func releasePayment(ctx context.Context, order Order) error {
+	payment := order.ActivePayment()
+	if payment == nil {
+		return nil
+	}
+
+	set := bson.M{}
+	if payment.Status == "authorized" {
+		if err := payments.Default.Void(ctx, payment.AuthorizationID); err != nil {
+			return err
+		}
+		set["payments.$.status"] = "voided"
+	} else {
+		amount := payment.CapturedAmount - payment.RefundedAmount
+		if err := payments.Default.Refund(ctx, payment.AuthorizationID, amount); err != nil {
+			return err
+		}
+		set["payments.$.status"] = "refunded"
+		set["payments.$.refunded_amount"] = payment.CapturedAmount
+	}
+
+	now := time.Now()
+	set["updated_at"] = now
+	set["payments.$.updated_at"] = now
+	_, err := handlers.ordersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": order.ID, "payments._id": payment.ID},
+		bson.M{"$set": set},
+	)
+	return err
+}
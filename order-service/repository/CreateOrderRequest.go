@@ -4,6 +4,10 @@ type CreateOrderRequest struct {
 	UserID int `json:"user_id"`
 	Items  []struct {
 		ProductID string `json:"product_id"`
+		VariantID string `json:"variant_id"`
+		SKU       string `json:"sku"`
 		Quantity  int    `json:"quantity"`
 	} `json:"items"`
+	ShippingZone    string `json:"shipping_zone"`
+	ShippingService string `json:"shipping_service"`
 }
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"inventory/handlers"
+	"log"
+	"time"
+)
+
+// ExpirePendingOrders cancels every pending order created before the cutoff,
+// returning their stock. It returns how many orders were cancelled; orders
+// that changed status while the job ran are skipped.
+func ExpirePendingOrders(ctx context.Context, cutoff time.Time) (int, error) {
+	cursor, err := handlers.ordersCollection.Find(ctx, bson.M{
+		"status":     "pending",
+		"created_at": bson.M{"$lt": cutoff},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, order := range orders {
+		err := CancelOrder(ctx, order)
+		if err == ErrOrderChanged {
+			continue
+		}
+		if errors.Is(err, ErrPaymentNotReleased) {
+			// The order was cancelled all the same
+			log.Printf("Expired order %s: %v", order.ID.Hex(), err)
+			expired++
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to expire order %s: %v", order.ID.Hex(), err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
@@ -0,0 +1,6 @@
+package repository
+
+type PaymentRequest struct {
+	Source string  `json:"source"`
+	Amount float64 `json:"amount"`
+}
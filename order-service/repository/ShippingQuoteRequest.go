@@ -0,0 +1,10 @@
+package repository
+
+type ShippingQuoteRequest struct {
+	Items []struct {
+		ProductID string `json:"product_id"`
+		Quantity  int    `json:"quantity"`
+	} `json:"items"`
+	Zone    string `json:"zone"`
+	Service string `json:"service"`
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,21 +15,43 @@ import (
 	"time"
 )
 
+// orderTransitions lists the statuses an order may move to from each
+// status. Cancelled and delivered orders are final.
+var orderTransitions = map[string][]string{
+	"pending":    {"processing", "cancelled"},
+	"processing": {"shipped", "cancelled"},
+	"shipped":    {"delivered"},
+	"delivered":  {},
+	"cancelled":  {},
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateOrderStatus moves an order to another status along
+// orderTransitions. Every status after pending requires an authorized or
+// captured payment; cancelling restores the stock and releases the payment.
 func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	// Convert string ID to ObjectID
-	id, err := primitive.ObjectIDFromHex(idStr)
-	if err != nil {
-		handlers.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
-		return
+	// Look the order up by ObjectID, or by order number otherwise, within
+	// the request's tenant
+	filter := bson.M{"tenant_id": handlers.tenantFilter(r), "number": idStr}
+	if id, err := primitive.ObjectIDFromHex(idStr); err == nil {
+		filter = bson.M{"tenant_id": handlers.tenantFilter(r), "_id": id}
 	}
 
-	// Find order by ID
+	// Find order
 	var existingOrder Order
-	err = handlers.ordersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&existingOrder)
+	err := handlers.ordersCollection.FindOne(ctx, filter).Decode(&existingOrder)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			handlers.RespondWithError(w, http.StatusNotFound, "Order not found")
@@ -46,76 +70,61 @@ func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate status
-	validStatuses := map[string]bool{"pending": true, "processing": true, "shipped": true, "delivered": true, "cancelled": true}
-	if !validStatuses[req.Status] {
+	if _, ok := orderTransitions[req.Status]; !ok {
 		handlers.RespondWithError(w, http.StatusBadRequest, "Invalid status. Must be one of: pending, processing, shipped, delivered, cancelled")
 		return
 	}
+	if req.Status == existingOrder.Status {
+		handlers.RespondWithJSON(w, http.StatusOK, existingOrder)
+		return
+	}
+	if !containsStatus(orderTransitions[existingOrder.Status], req.Status) {
+		handlers.RespondWithError(w, http.StatusConflict, fmt.Sprintf("Cannot change order status from %s to %s", existingOrder.Status, req.Status))
+		return
+	}
 
-	// Start a session for transaction if we're cancelling an order
-	session, err := handlers.Client.StartSession()
-	if err != nil {
-		handlers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	// Orders only move past pending once their payment has been authorized
+	if req.Status != "cancelled" && existingOrder.ActivePayment() == nil {
+		handlers.RespondWithError(w, http.StatusPaymentRequired, "Order has no authorized payment")
 		return
 	}
-	defer session.EndSession(ctx)
 
 	// Handle cancellation with transaction
 	if existingOrder.Status != "cancelled" && req.Status == "cancelled" {
-		err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
-			// Transaction started
-			if err := session.StartTransaction(); err != nil {
-				return err
-			}
-
-			// Restore stock for each item
-			for _, item := range existingOrder.Items {
-				_, err = handlers.productsCollection.UpdateOne(
-					sessionContext,
-					bson.M{"_id": item.ProductID},
-					bson.M{"$inc": bson.M{"stock_level": item.Quantity}, "$set": bson.M{"updated_at": time.Now()}},
-				)
-				if err != nil {
-					return err
-				}
-			}
-
-			// Update order status
-			_, err = handlers.ordersCollection.UpdateOne(
-				sessionContext,
-				bson.M{"_id": id},
-				bson.M{"$set": bson.M{"status": req.Status, "updated_at": time.Now()}},
-			)
-			if err != nil {
-				return err
-			}
-
-			// Commit the transaction
-			return session.CommitTransaction(sessionContext)
-		})
-
+		err = CancelOrder(ctx, existingOrder)
+		if err == ErrOrderChanged {
+			handlers.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, ErrPaymentNotReleased) {
+			handlers.RespondWithError(w, http.StatusBadGateway, err.Error())
+			return
+		}
 		if err != nil {
-			// Transaction failed, handle the error
-			session.AbortTransaction(ctx)
 			handlers.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 	} else {
-		// Simple status update (no stock restoration needed)
-		_, err = handlers.ordersCollection.UpdateOne(
+		// Simple status update (no stock restoration needed), only over the
+		// status the transition was checked from
+		result, err := handlers.ordersCollection.UpdateOne(
 			ctx,
-			bson.M{"_id": id},
+			bson.M{"_id": existingOrder.ID, "tenant_id": handlers.tenantFilter(r), "status": existingOrder.Status},
 			bson.M{"$set": bson.M{"status": req.Status, "updated_at": time.Now()}},
 		)
 		if err != nil {
 			handlers.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		if result.MatchedCount == 0 {
+			handlers.RespondWithError(w, http.StatusConflict, ErrOrderChanged.Error())
+			return
+		}
 	}
 
 	// Get updated order
 	var updatedOrder Order
-	err = handlers.ordersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&updatedOrder)
+	err = handlers.ordersCollection.FindOne(ctx, bson.M{"_id": existingOrder.ID}).Decode(&updatedOrder)
 	if err != nil {
 		handlers.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return